@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/DanielNikkari/maahinen/internal/session"
+)
+
+// cliOptions holds the options parsed from the command line
+type cliOptions struct {
+	headless bool
+	prompt   string
+	yes      bool
+	model    string
+	resume   string
+	cont     bool
+	sandbox  bool
+}
+
+// usage prints the command line usage, set by parseArgs
+var usage = func(w io.Writer) {}
+
+// parseArgs parses command line arguments
+// Headless mode is selected with either `maahinen run "prompt"` or `maahinen -p "prompt"`
+func parseArgs(args []string) (*cliOptions, error) {
+	opts := &cliOptions{}
+
+	if len(args) > 0 && args[0] == "run" {
+		opts.headless = true
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet("maahinen", flag.ContinueOnError)
+	fs.StringVar(&opts.prompt, "p", "", "run a single prompt without the TUI")
+	fs.BoolVar(&opts.yes, "yes", false, "auto-confirm all tool calls in headless mode")
+	fs.BoolVar(&opts.yes, "y", false, "shorthand for --yes")
+	fs.StringVar(&opts.model, "model", "", "model to use (overrides config default)")
+	fs.StringVar(&opts.resume, "resume", "", "resume a saved session by ID")
+	fs.BoolVar(&opts.cont, "continue", false, "continue the most recent session")
+	fs.BoolVar(&opts.sandbox, "sandbox", false, "run bash commands in a sandbox (Linux only, overrides config)")
+	// Errors and usage are printed by the caller
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
+	usage = func(w io.Writer) {
+		fmt.Fprintln(w, "Usage:")
+		fmt.Fprintln(w, "  maahinen                 start the interactive TUI")
+		fmt.Fprintln(w, "  maahinen run [flags] \"prompt\"")
+		fmt.Fprintln(w, "  maahinen -p \"prompt\" [flags]")
+		fmt.Fprintln(w, "\nFlags:")
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if opts.prompt != "" {
+		opts.headless = true
+	}
+	if rest := strings.TrimSpace(strings.Join(fs.Args(), " ")); rest != "" {
+		if !opts.headless {
+			return nil, fmt.Errorf("unexpected arguments: %s", rest)
+		}
+		if opts.prompt != "" {
+			opts.prompt += " "
+		}
+		opts.prompt += rest
+	}
+
+	return opts, nil
+}
+
+// readPipedStdin returns stdin contents when input is piped rather than a terminal
+func readPipedStdin() (string, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.Mode()&os.ModeCharDevice != 0 {
+		return "", nil
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read stdin: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// loadSession loads the session requested with --resume or --continue
+// Returns nil if neither flag was given or there is no session to continue
+func loadSession(store *session.Store, opts *cliOptions) (*session.Session, error) {
+	switch {
+	case opts.resume != "":
+		return store.Load(opts.resume)
+	case opts.cont:
+		sessions, err := store.List()
+		if err != nil || len(sessions) == 0 {
+			return nil, err
+		}
+		return sessions[0], nil
+	}
+	return nil, nil
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/DanielNikkari/maahinen/internal/config"
 	"github.com/DanielNikkari/maahinen/internal/llm"
+	"github.com/DanielNikkari/maahinen/internal/mcp"
+	"github.com/DanielNikkari/maahinen/internal/session"
 	"github.com/DanielNikkari/maahinen/internal/setup"
 	"github.com/DanielNikkari/maahinen/internal/tools"
 	"github.com/DanielNikkari/maahinen/internal/tui"
@@ -15,44 +20,62 @@ import (
 )
 
 func main() {
+	opts, err := parseArgs(os.Args[1:])
+	if err != nil {
+		if err == flag.ErrHelp {
+			usage(os.Stdout)
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, ui.Color(ui.Red, fmt.Sprintf("Error: %v", err)))
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
 	// Load configuration
 	cfg, err := config.Load("")
 	if err != nil {
 		fmt.Fprintln(os.Stderr, ui.Color(ui.Red, fmt.Sprintf("Error loading config: %v", err)))
 		os.Exit(1)
 	}
-
-	selectedModel, err := setup.Run()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, ui.Color(ui.Red, fmt.Sprintf("Error: %v", err)))
-		os.Exit(1)
+	if opts.sandbox {
+		cfg.Sandbox.Enabled = true
 	}
 
-	// Get Ollama URL from env, config, or use default
-	ollamaURL := os.Getenv("OLLAMA_URL")
-	if ollamaURL == "" {
-		ollamaURL = cfg.Ollama.BaseURL
-	}
-	if ollamaURL == "" {
-		ollamaURL = "http://localhost:11434"
+	if opts.headless {
+		os.Exit(runHeadless(cfg, opts))
 	}
 
-	// Use selected model from setup, or fall back to config default
-	modelToUse := selectedModel
-	if modelToUse == "" {
-		modelToUse = cfg.Ollama.DefaultModel
+	// Use model from flag, or the one selected during setup
+	modelToUse := opts.model
+	if cfg.Provider == llm.ProviderOllama {
+		selectedModel, err := setup.Run()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, ui.Color(ui.Red, fmt.Sprintf("Error: %v", err)))
+			os.Exit(1)
+		}
+		if modelToUse == "" {
+			modelToUse = selectedModel
+		}
 	}
 
 	// Create LLM client
-	client := llm.NewClient(ollamaURL, modelToUse)
+	client, err := newClient(cfg, modelToUse)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.Color(ui.Red, fmt.Sprintf("Error: %v", err)))
+		os.Exit(1)
+	}
 
-	// Create tool registry
-	registry := tools.NewRegistry()
-	registry.Register(tools.NewBashTool(""))
-	registry.Register(tools.NewReadTool(""))
-	registry.Register(tools.NewWriteTool(""))
-	registry.Register(tools.NewEditTool(""))
-	registry.Register(tools.NewListTool(""))
+	// Create tool registry, background processes and MCP servers are stopped when the program exits
+	procs := tools.NewProcessManager("")
+	servers := mcp.NewManager(cfg.MCP.Servers)
+	registry, err := newToolRegistry(cfg, procs, servers)
+	if err != nil {
+		servers.Close()
+		fmt.Fprintln(os.Stderr, ui.Color(ui.Red, fmt.Sprintf("Error: %v", err)))
+		os.Exit(1)
+	}
+	defer procs.KillAll()
+	defer servers.Close()
 
 	// Set up debug logging
 	if err := os.MkdirAll("logs", 0755); err != nil {
@@ -68,6 +91,20 @@ func main() {
 	// Create the TUI agent with config
 	agent := tui.NewTUIAgent(client, registry, cfg)
 	defer agent.Close()
+	agent.SetProcessManager(procs)
+	agent.SetMCPManager(servers)
+
+	// Enable session persistence and resume a previous session if requested
+	store := session.NewStore(session.DefaultDir())
+	agent.SetSessionStore(store)
+	sess, err := loadSession(store, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.Color(ui.Red, fmt.Sprintf("Error resuming session: %v", err)))
+		os.Exit(1)
+	}
+	if sess != nil {
+		agent.ResumeSession(sess)
+	}
 
 	// Create the TUI program and model
 	program, model, err := tui.StartProgram()
@@ -85,7 +122,130 @@ func main() {
 
 	// Run the TUI
 	if _, err := program.Run(); err != nil {
+		procs.KillAll()
+		servers.Close()
 		fmt.Fprintln(os.Stderr, ui.Color(ui.Red, fmt.Sprintf("Error running TUI: %v", err)))
 		os.Exit(1)
 	}
 }
+
+// resolveOllamaURL gets the Ollama URL from env, config, or uses the default
+func resolveOllamaURL(cfg *config.Config) string {
+	ollamaURL := os.Getenv("OLLAMA_URL")
+	if ollamaURL == "" {
+		ollamaURL = cfg.Ollama.BaseURL
+	}
+	if ollamaURL == "" {
+		ollamaURL = "http://localhost:11434"
+	}
+	return ollamaURL
+}
+
+// resolveOpenAIURL gets the OpenAI-compatible server URL from env or config
+func resolveOpenAIURL(cfg *config.Config) string {
+	if url := os.Getenv("OPENAI_BASE_URL"); url != "" {
+		return url
+	}
+	return cfg.OpenAI.BaseURL
+}
+
+// resolveOpenAIKey gets the API key from env or config
+func resolveOpenAIKey(cfg *config.Config) string {
+	if key := os.Getenv("OPENAI_API_KEY"); key != "" {
+		return key
+	}
+	return cfg.OpenAI.APIKey
+}
+
+// newClient creates the LLM client for the configured provider
+// If no model is given, the configured default is used. For OpenAI-compatible servers
+// without a default, the first model the server offers is used.
+func newClient(cfg *config.Config, model string) (*llm.Client, error) {
+	if cfg.Provider != llm.ProviderOpenAI {
+		if model == "" {
+			model = cfg.Ollama.DefaultModel
+		}
+		return llm.NewClient(resolveOllamaURL(cfg), model), nil
+	}
+
+	if model == "" {
+		model = cfg.OpenAI.DefaultModel
+	}
+	provider := llm.NewOpenAIProvider(resolveOpenAIURL(cfg), resolveOpenAIKey(cfg))
+	client := llm.NewClientWithProvider(provider, model)
+	if model != "" {
+		return client, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	models, err := client.ListModels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models at %s: %w", client.BaseURL(), err)
+	}
+	if len(models) == 0 {
+		return nil, fmt.Errorf("no models available at %s", client.BaseURL())
+	}
+	client.SetModel(models[0])
+	return client, nil
+}
+
+// newToolRegistry creates the registry with all built-in tools and the tools of the MCP servers
+// File tools are confined to the configured workspace and bash runs in the sandbox if enabled.
+// Background commands are started with procs. The MCP servers are started here, the caller
+// closes them
+func newToolRegistry(cfg *config.Config, procs *tools.ProcessManager, servers *mcp.Manager) (*tools.Registry, error) {
+	ws, err := tools.NewWorkspace(cfg.Workspace.Root, cfg.Workspace.Allow)
+	if err != nil {
+		return nil, err
+	}
+
+	bash := tools.NewBashTool(ws.Root())
+	bash.SetTimeout(time.Duration(cfg.Bash.Timeout) * time.Second)
+	bash.SetMaxTimeout(time.Duration(cfg.Bash.MaxTimeout) * time.Second)
+	bash.SetMaxOutput(cfg.Bash.MaxOutput)
+	if cfg.Sandbox.Enabled {
+		sandbox, err := tools.NewSandbox(ws.Root(), tools.SandboxOptions{
+			Network:      cfg.Sandbox.Network,
+			Writable:     cfg.Sandbox.Writable,
+			CPUSeconds:   cfg.Sandbox.CPUSeconds,
+			MemoryMB:     cfg.Sandbox.MemoryMB,
+			MaxProcesses: cfg.Sandbox.MaxProcesses,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w, disable sandbox in the config to run commands directly", err)
+		}
+		bash.SetSandbox(sandbox)
+		procs.SetSandbox(sandbox)
+	}
+	procs.SetWorkDir(ws.Root())
+
+	registry := tools.NewRegistry()
+	registry.Register(bash)
+	registry.Register(tools.NewReadTool(ws))
+	registry.Register(tools.NewWriteTool(ws))
+	registry.Register(tools.NewEditTool(ws))
+	registry.Register(tools.NewListTool(ws))
+	registry.Register(tools.NewSearchTool(ws))
+	registry.Register(tools.NewGlobTool(ws))
+	registry.Register(tools.NewPatchTool(ws))
+	background := tools.NewBackgroundTool(procs)
+	background.FollowShell(bash)
+	registry.Register(background)
+	registry.Register(tools.NewProcessOutputTool(procs))
+	registry.Register(tools.NewProcessKillTool(procs))
+	registry.Register(tools.NewProcessListTool(procs))
+
+	servers.SetWorkDir(ws.Root())
+	servers.Start(context.Background())
+	for _, t := range servers.Tools() {
+		registry.Register(t)
+	}
+
+	for alias, tool := range cfg.Tools.Aliases {
+		if err := registry.AddAlias(alias, tool); err != nil {
+			return nil, fmt.Errorf("invalid tool alias in config: %w", err)
+		}
+	}
+	return registry, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/DanielNikkari/maahinen/internal/config"
+	"github.com/DanielNikkari/maahinen/internal/headless"
+	"github.com/DanielNikkari/maahinen/internal/llm"
+	"github.com/DanielNikkari/maahinen/internal/mcp"
+	"github.com/DanielNikkari/maahinen/internal/ollama"
+	"github.com/DanielNikkari/maahinen/internal/session"
+	"github.com/DanielNikkari/maahinen/internal/tools"
+	"github.com/DanielNikkari/maahinen/internal/ui"
+)
+
+// runHeadless runs a single prompt through the agent loop without the TUI
+// Returns the process exit code
+func runHeadless(cfg *config.Config, opts *cliOptions) int {
+	piped, err := readPipedStdin()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.Color(ui.Red, fmt.Sprintf("Error: %v", err)))
+		return 1
+	}
+
+	prompt := opts.prompt
+	if piped != "" {
+		if prompt != "" {
+			prompt += "\n\n"
+		}
+		prompt += piped
+	}
+	if prompt == "" {
+		fmt.Fprintln(os.Stderr, ui.Color(ui.Red, "Error: no prompt given"))
+		return 2
+	}
+
+	if cfg.Provider == llm.ProviderOllama {
+		ollamaURL := resolveOllamaURL(cfg)
+		if !ollama.IsRunningAt(ollamaURL) {
+			fmt.Fprintln(os.Stderr, ui.Color(ui.Red, fmt.Sprintf("Error: Ollama server is not running at %s", ollamaURL)))
+			return 1
+		}
+	}
+
+	client, err := newClient(cfg, opts.model)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.Color(ui.Red, fmt.Sprintf("Error: %v", err)))
+		return 1
+	}
+	procs := tools.NewProcessManager("")
+	servers := mcp.NewManager(cfg.MCP.Servers)
+	registry, err := newToolRegistry(cfg, procs, servers)
+	defer servers.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.Color(ui.Red, fmt.Sprintf("Error: %v", err)))
+		return 1
+	}
+	defer procs.KillAll()
+	for _, st := range servers.Status() {
+		if st.State == mcp.StateFailed {
+			fmt.Fprintln(os.Stderr, ui.Color(ui.Yellow, fmt.Sprintf("Warning: MCP server '%s' failed to start: %s", st.Name, st.Error)))
+		}
+	}
+	runner := headless.NewRunner(client, registry, cfg)
+	if opts.yes {
+		runner.SetAutoConfirm(true)
+	}
+
+	store := session.NewStore(session.DefaultDir())
+	runner.SetSessionStore(store)
+	sess, err := loadSession(store, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ui.Color(ui.Red, fmt.Sprintf("Error resuming session: %v", err)))
+		return 1
+	}
+	if sess != nil {
+		runner.ResumeSession(sess)
+	}
+
+	// Ctrl+C cancels the run instead of killing the process mid-write
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := runner.Run(ctx, prompt); err != nil {
+		if errors.Is(err, context.Canceled) {
+			fmt.Fprintln(os.Stderr, ui.Color(ui.Yellow, "Cancelled"))
+			return 130
+		}
+		fmt.Fprintln(os.Stderr, ui.Color(ui.Red, fmt.Sprintf("Error: %v", err)))
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,394 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DanielNikkari/maahinen/internal/config"
+	"github.com/DanielNikkari/maahinen/internal/llm"
+	"github.com/DanielNikkari/maahinen/internal/permission"
+	"github.com/DanielNikkari/maahinen/internal/session"
+	"github.com/DanielNikkari/maahinen/internal/tools"
+)
+
+// Agent runs the tool-calling conversation loop independently of any UI
+// Progress is reported to a Sink and tool calls are approved through a Confirmer
+type Agent struct {
+	client   *llm.Client
+	messages []llm.Message
+	tools    *tools.Registry
+	logFile  *os.File
+
+	// System prompt used when starting a new conversation
+	systemPrompt string
+
+	// Generation options from the config and overrides set for the current session
+	ollama         config.OllamaConfig
+	sessionOptions llm.Options
+
+	// Context compaction settings and the last token count reported by the model
+	compaction       config.CompactionConfig
+	measuredTokens   int
+	measuredMessages int
+
+	// Session persistence (store is nil when sessions are not saved)
+	store   *session.Store
+	session *session.Session
+
+	sink      Sink
+	confirmer Confirmer
+	// Calls no permission rule matches run without asking when autoConfirm is set
+	policy      *permission.Policy
+	autoConfirm bool
+
+	// Cancels the turn in progress
+	cancel   context.CancelFunc
+	cancelMu sync.Mutex
+}
+
+// New creates a new agent
+func New(client *llm.Client, registry *tools.Registry, cfg *config.Config) *Agent {
+	// Register tools in registry
+	for _, tool := range registry.All() {
+		client.RegisterTool(tool.Definition())
+	}
+
+	// Set up tool call logging
+	logDir := "logs"
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		log.Printf("Warning: could not create logs directory: %v", err)
+	}
+
+	logPath := filepath.Join(logDir, fmt.Sprintf("tools_%s.log", time.Now().Format("2006-01-02")))
+	logFile, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("Warning: could not open tool log file: %v", err)
+	}
+
+	// Permission rules from the config and the ones saved with "always allow"
+	policy := permission.New(cfg.Workspace.Root, cfg.Permissions)
+	if err := policy.Load(permission.DefaultPath()); err != nil {
+		log.Printf("Warning: could not load permission rules: %v", err)
+	}
+
+	// Use config values or defaults
+	systemPrompt := cfg.Agent.SystemPrompt
+	if systemPrompt == "" {
+		systemPrompt = config.DefaultConfig().Agent.SystemPrompt
+	}
+
+	a := &Agent{
+		client:       client,
+		tools:        registry,
+		logFile:      logFile,
+		systemPrompt: systemPrompt,
+		ollama:       cfg.Ollama,
+		compaction:   cfg.Agent.Compaction,
+		session:      session.New(client.Model()),
+		policy:       policy,
+		autoConfirm:  cfg.Agent.AutoConfirm,
+		messages: []llm.Message{
+			{
+				Role:    llm.RoleSystem,
+				Content: systemPrompt,
+			},
+		},
+	}
+	a.applyOptions()
+	return a
+}
+
+// SetSessionStore enables saving the conversation to the given store
+func (a *Agent) SetSessionStore(store *session.Store) {
+	a.store = store
+}
+
+// Session returns the current session
+func (a *Agent) Session() *session.Session {
+	return a.session
+}
+
+// NewSession starts a new conversation, keeping the previous one in the store
+func (a *Agent) NewSession() {
+	a.messages = []llm.Message{
+		{
+			Role:    llm.RoleSystem,
+			Content: a.systemPrompt,
+		},
+	}
+	a.session = session.New(a.client.Model())
+	a.measuredTokens = 0
+	a.measuredMessages = 0
+	a.sessionOptions = llm.Options{}
+	a.policy.ClearSession()
+	a.tools.ResetSession()
+	a.applyOptions()
+}
+
+// ResumeSession replaces the conversation with a stored session
+func (a *Agent) ResumeSession(s *session.Session) {
+	messages := s.Messages
+	if len(messages) == 0 || messages[0].Role != llm.RoleSystem {
+		messages = append([]llm.Message{{Role: llm.RoleSystem, Content: a.systemPrompt}}, messages...)
+	}
+	a.messages = mergeSystemMessages(messages)
+	a.session = s
+	a.measuredTokens = 0
+	a.measuredMessages = 0
+	a.sessionOptions = llm.Options{}
+	a.policy.ClearSession()
+	a.tools.ResetSession()
+
+	if s.Model != "" && s.Model != a.client.Model() {
+		a.SetModel(s.Model)
+	} else {
+		a.applyOptions()
+	}
+}
+
+// saveSession writes the current conversation to the session store
+func (a *Agent) saveSession() {
+	if a.store == nil {
+		return
+	}
+
+	a.session.Messages = a.Messages()
+	a.session.Model = a.client.Model()
+	if !a.session.HasHistory() {
+		return
+	}
+
+	if err := a.store.Save(a.session); err != nil {
+		log.Printf("Warning: could not save session: %v", err)
+	}
+}
+
+// recordToolCall adds a tool call to the session's tool call records
+func (a *Agent) recordToolCall(id, name string, args map[string]any, status, output, errMsg string) {
+	a.session.ToolCalls = append(a.session.ToolCalls, session.ToolCall{
+		ID:        id,
+		Name:      name,
+		Arguments: args,
+		Status:    status,
+		Output:    output,
+		Error:     errMsg,
+	})
+}
+
+// SetSink sets where agent events are sent
+func (a *Agent) SetSink(s Sink) {
+	a.sink = s
+}
+
+// SetConfirmer sets how tool calls are confirmed when auto-confirm is off
+func (a *Agent) SetConfirmer(c Confirmer) {
+	a.confirmer = c
+}
+
+// SetAutoConfirm sets whether tools should be auto-confirmed
+func (a *Agent) SetAutoConfirm(auto bool) {
+	a.autoConfirm = auto
+}
+
+// AutoConfirm reports whether tools are auto-confirmed
+func (a *Agent) AutoConfirm() bool {
+	return a.autoConfirm
+}
+
+// PermissionRules returns the permission rules in the order they are checked
+func (a *Agent) PermissionRules() []permission.Rule {
+	return a.policy.Rules()
+}
+
+// Model returns the name of the active model
+func (a *Agent) Model() string {
+	return a.client.Model()
+}
+
+// SetModel switches the active model
+func (a *Agent) SetModel(model string) {
+	a.client.SetModel(model)
+	a.emit(ModelChangedEvent{Model: model})
+	// Per-model overrides may differ
+	a.applyOptions()
+}
+
+// Messages returns a copy of the conversation history
+func (a *Agent) Messages() []llm.Message {
+	messages := make([]llm.Message, len(a.messages))
+	copy(messages, a.messages)
+	return messages
+}
+
+// Prune clears the message history while keeping the system prompt
+// The pruned conversation stays in the session store and a new session is started
+func (a *Agent) Prune() {
+	a.NewSession()
+}
+
+// Run adds a user message to the history and processes the model's response,
+// executing tool calls until the model gives a final answer
+// The turn can be stopped with Cancel, in which case context.Canceled is returned
+func (a *Agent) Run(ctx context.Context, content string) error {
+	ctx, done := a.cancellable(ctx)
+	defer done()
+	defer a.saveSession()
+
+	a.messages = append(a.messages, llm.Message{
+		Role:    llm.RoleUser,
+		Content: content,
+	})
+
+	if err := a.processResponse(ctx); err != nil {
+		if ctx.Err() != nil {
+			a.emit(TurnCancelledEvent{})
+			return context.Canceled
+		}
+		a.emit(ErrorEvent{Err: err})
+		return err
+	}
+	return nil
+}
+
+// cancellable returns a context Cancel stops, and a function to call when the work is done
+func (a *Agent) cancellable(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	a.cancelMu.Lock()
+	a.cancel = cancel
+	a.cancelMu.Unlock()
+
+	return ctx, func() {
+		a.cancelMu.Lock()
+		a.cancel = nil
+		a.cancelMu.Unlock()
+		cancel()
+	}
+}
+
+// Cancel stops the turn or compaction in progress, aborting the model request or running tool
+func (a *Agent) Cancel() {
+	a.cancelMu.Lock()
+	defer a.cancelMu.Unlock()
+
+	if a.cancel != nil {
+		a.cancel()
+	}
+}
+
+// processResponse handles LLM response processing with streaming
+func (a *Agent) processResponse(ctx context.Context) error {
+	for {
+		// Make room in the context window before sending the next request
+		a.maybeCompact(ctx)
+
+		// Use streaming to show response as it's generated
+		// Tool calls written as text are held back instead of being shown
+		var detector callDetector
+		resp, err := a.client.ChatStream(ctx, a.messages, func(chunk string, done bool, fullMessage *llm.Message) {
+			if done || chunk == "" {
+				return
+			}
+			show, started := detector.Write(chunk)
+			if show != "" {
+				a.emit(StreamChunkEvent{Content: show})
+			}
+			if started {
+				a.emit(ToolCallPreparingEvent{})
+			}
+		})
+		if err != nil {
+			// Keep the text generated before the request was cancelled
+			if ctx.Err() != nil && resp != nil && resp.Content != "" {
+				a.messages = append(a.messages, llm.Message{
+					Role:    llm.RoleAssistant,
+					Content: resp.Content,
+				})
+			}
+			return err
+		}
+
+		assignToolCallIDs(resp.ToolCalls)
+		a.messages = append(a.messages, *resp)
+		a.recordUsage()
+
+		// Check for native tool calls
+		if resp.HasToolCalls() {
+			// The calls came separately, so anything held back was only text
+			a.emit(StreamChunkEvent{Content: detector.Flush()})
+			// Signal end of streaming before handling tools
+			a.emit(StreamChunkEvent{Done: true})
+
+			if err := a.executeTools(ctx, resp.ToolCalls); err != nil {
+				return err
+			}
+			continue // Continue the conversation with tool results
+		}
+
+		// Check for tool calls written in the content
+		if calls := a.tools.ParseToolCalls(resp.Content); len(calls) > 0 {
+			// Show text held back only because it might have started a call
+			if !detector.Holding() {
+				a.emit(StreamChunkEvent{Content: detector.Flush()})
+			}
+			// Signal end of streaming before handling tools
+			a.emit(StreamChunkEvent{Done: true})
+
+			// Attach the calls to the assistant message so the results can be paired with them
+			assignToolCallIDs(calls)
+			a.messages[len(a.messages)-1].ToolCalls = calls
+
+			if err := a.executeTools(ctx, calls); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Regular text response - show anything held back and signal completion
+		if resp.Content != "" {
+			a.emit(StreamChunkEvent{Content: detector.Flush(), Done: true})
+		}
+		return nil
+	}
+}
+
+// emit sends an event to the sink if one is set
+func (a *Agent) emit(e Event) {
+	if a.sink != nil {
+		a.sink.Emit(e)
+	}
+}
+
+// logToolCall logs a tool call to the log file
+func (a *Agent) logToolCall(id, name string, args map[string]any, status string) {
+	if a.logFile == nil {
+		return
+	}
+
+	timestamp := time.Now().Format(time.RFC3339)
+	argsStr := ""
+	if args != nil {
+		var parts []string
+		for k, v := range args {
+			parts = append(parts, fmt.Sprintf("%s=%v", k, v))
+		}
+		argsStr = strings.Join(parts, ", ")
+	}
+
+	logLine := fmt.Sprintf("[%s] %s | tool=%s | args={%s} | status=%s\n",
+		timestamp, id, name, argsStr, status)
+
+	a.logFile.WriteString(logLine)
+}
+
+// Close cleans up resources
+func (a *Agent) Close() {
+	if a.logFile != nil {
+		a.logFile.Close()
+	}
+}
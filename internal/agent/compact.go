@@ -0,0 +1,200 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/DanielNikkari/maahinen/internal/llm"
+)
+
+// Longest tool output included verbatim in the transcript sent for summarization
+const maxSummaryToolOutput = 2000
+
+const summaryPrompt = `You are summarizing the earlier part of a conversation between a user and a coding assistant
+so the assistant can continue the work with less context. Write a concise summary that keeps:
+- the user's goals and requests
+- files that were read, created or changed, and what changed in them
+- commands that were run and their important results or errors
+- decisions made and any open tasks
+Do not add commentary. Respond only with the summary.`
+
+// summaryPrefix starts the summary of compacted conversation turns, which is added to
+// the system message since chat templates expect only one system message, at the start
+const summaryPrefix = "Summary of the earlier conversation:\n"
+
+// ContextTokens returns the number of tokens the conversation currently takes
+// The last count reported by the model is used where available, newer messages are estimated
+func (a *Agent) ContextTokens() int {
+	estimated := llm.EstimateMessagesTokens(a.messages)
+	if a.measuredMessages == 0 || a.measuredMessages > len(a.messages) {
+		return estimated
+	}
+
+	measured := a.measuredTokens + llm.EstimateMessagesTokens(a.messages[a.measuredMessages:])
+	return max(measured, estimated)
+}
+
+// ContextWindow returns the model's context size in tokens
+// num_ctx takes precedence over the compaction setting since it is what the model actually gets
+func (a *Agent) ContextWindow() int {
+	if numCtx := a.client.Options().NumCtx; numCtx != nil {
+		return *numCtx
+	}
+	return a.compaction.ContextWindow
+}
+
+// recordUsage stores the token counts reported for the last model response
+// Must be called right after the response is appended to the history
+func (a *Agent) recordUsage() {
+	usage := a.client.LastUsage()
+	if usage.Total() == 0 {
+		return
+	}
+	a.measuredTokens = usage.Total()
+	a.measuredMessages = len(a.messages)
+}
+
+// needsCompaction reports whether the conversation is close enough to the context window to compact
+func (a *Agent) needsCompaction() bool {
+	window := a.ContextWindow()
+	if !a.compaction.Enabled || window <= 0 {
+		return false
+	}
+	limit := int(float64(window) * a.compaction.Threshold)
+	return a.ContextTokens() >= limit
+}
+
+// maybeCompact compacts the conversation if it is approaching the context window
+func (a *Agent) maybeCompact(ctx context.Context) {
+	if !a.needsCompaction() {
+		return
+	}
+	before, after, err := a.compact(ctx)
+	if err != nil {
+		log.Printf("Warning: automatic context compaction failed: %v", err)
+		return
+	}
+	a.emit(ContextCompactedEvent{Before: before, After: after})
+}
+
+// Compact summarizes older conversation turns with the current model
+// The system prompt and the most recent turns are kept verbatim, the summary is appended to
+// the system prompt. A summary from an earlier compaction is summarized again with the turns
+// Returns the estimated token counts before and after compaction
+// It can be stopped with Cancel, in which case the history is left unchanged
+func (a *Agent) Compact(ctx context.Context) (int, int, error) {
+	ctx, done := a.cancellable(ctx)
+	defer done()
+	return a.compact(ctx)
+}
+
+// compact does the work of Compact, within a turn whose cancel func is already registered
+func (a *Agent) compact(ctx context.Context) (int, int, error) {
+	before := a.ContextTokens()
+
+	start := 0
+	if len(a.messages) > 0 && a.messages[0].Role == llm.RoleSystem {
+		start = 1
+	}
+	end := a.recentTurnsStart()
+	if end <= start {
+		return before, before, fmt.Errorf("nothing to compact")
+	}
+
+	system := ""
+	if start == 1 {
+		system = a.messages[0].Content
+	}
+	prompt, earlier, _ := strings.Cut(system, summaryPrefix)
+	prompt = strings.TrimSpace(prompt)
+
+	transcript := formatTranscript(a.messages[start:end])
+	if earlier != "" {
+		transcript = summaryPrefix + earlier + "\n\n" + transcript
+	}
+	resp, err := a.client.ChatPlain(ctx, []llm.Message{
+		{Role: llm.RoleSystem, Content: summaryPrompt},
+		{Role: llm.RoleUser, Content: transcript},
+	})
+	if err != nil {
+		return before, before, fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+
+	summary := strings.TrimSpace(resp.Content)
+	if summary == "" {
+		return before, before, fmt.Errorf("model returned an empty summary")
+	}
+
+	content := summaryPrefix + summary
+	if prompt != "" {
+		content = prompt + "\n\n" + content
+	}
+	compacted := make([]llm.Message, 0, 1+len(a.messages)-end)
+	compacted = append(compacted, llm.Message{
+		Role:    llm.RoleSystem,
+		Content: content,
+	})
+	compacted = append(compacted, a.messages[end:]...)
+
+	a.messages = compacted
+	a.measuredTokens = 0
+	a.measuredMessages = 0
+
+	return before, a.ContextTokens(), nil
+}
+
+// mergeSystemMessages moves system messages after the first one into it
+// Sessions compacted by older versions have the summary as a later system message
+func mergeSystemMessages(messages []llm.Message) []llm.Message {
+	merged := []llm.Message{messages[0]}
+	for _, m := range messages[1:] {
+		if m.Role == llm.RoleSystem {
+			merged[0].Content = strings.TrimSpace(merged[0].Content) + "\n\n" + m.Content
+			continue
+		}
+		merged = append(merged, m)
+	}
+	return merged
+}
+
+// recentTurnsStart returns the index of the first message of the turns kept verbatim
+func (a *Agent) recentTurnsStart() int {
+	keep := max(a.compaction.KeepRecentTurns, 1)
+
+	turns := 0
+	for i := len(a.messages) - 1; i >= 0; i-- {
+		if a.messages[i].Role != llm.RoleUser {
+			continue
+		}
+		turns++
+		if turns == keep {
+			return i
+		}
+	}
+	return 0
+}
+
+// formatTranscript renders messages as plain text for summarization
+func formatTranscript(messages []llm.Message) string {
+	var sb strings.Builder
+	for _, m := range messages {
+		content := m.Content
+		if m.Role == llm.RoleTool && len(content) > maxSummaryToolOutput {
+			content = content[:maxSummaryToolOutput] + "\n... (truncated)"
+		}
+
+		sb.WriteString(fmt.Sprintf("[%s]\n", m.Role))
+		if content != "" {
+			sb.WriteString(content + "\n")
+		}
+		for _, tc := range m.ToolCalls {
+			args, _ := json.Marshal(tc.Function.Arguments)
+			sb.WriteString(fmt.Sprintf("tool call: %s %s\n", tc.Function.Name, args))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
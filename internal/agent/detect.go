@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"strings"
+)
+
+// toolCallMarkers start a tool call written as text wherever they appear
+var toolCallMarkers = []string{"<tool_call>", "<|python_tag|>", "[TOOL_CALLS]", "<function="}
+
+// toolCallKeys are the first keys of JSON objects that start a tool call
+var toolCallKeys = map[string]bool{"name": true, "function": true, "tool": true, "tool_calls": true, "type": true}
+
+// fenceLanguages are the code fence languages models put tool call JSON in
+var fenceLanguages = map[string]bool{"": true, "json": true, "tool_call": true, "tool_code": true}
+
+// callDetector holds back streamed text once it looks like the start of a tool call, so
+// raw tool call JSON isn't shown as part of the assistant's message
+// Text that could still turn into a call start, like a partial "<tool_", is held back too
+// until the next chunk decides it
+type callDetector struct {
+	content strings.Builder
+	shown   int  // bytes of content passed on to be shown
+	holding bool // a tool call started, nothing more is shown
+}
+
+// Write adds a streamed chunk and returns the text that can be shown now
+// started is true for the chunk in which a tool call starts
+func (d *callDetector) Write(chunk string) (show string, started bool) {
+	d.content.WriteString(chunk)
+	if d.holding {
+		return "", false
+	}
+
+	content := d.content.String()
+	for i := d.shown; i < len(content); i++ {
+		switch content[i] {
+		case '<', '[', '`', '{':
+		default:
+			continue
+		}
+		if inThinking(content[:i]) {
+			continue
+		}
+
+		match, maybe := callStart(content[i:], atLineStart(content, i))
+		if !match && !maybe {
+			continue
+		}
+		show = content[d.shown:i]
+		d.shown = i
+		if match {
+			d.holding = true
+			return show, true
+		}
+		return show, false
+	}
+
+	show = content[d.shown:]
+	d.shown = len(content)
+	return show, false
+}
+
+// Holding reports whether a tool call started in the streamed text
+func (d *callDetector) Holding() bool {
+	return d.holding
+}
+
+// Flush returns the text held back, to be shown when it didn't contain a tool call after all
+func (d *callDetector) Flush() string {
+	content := d.content.String()
+	rest := content[d.shown:]
+	d.shown = len(content)
+	d.holding = false
+	return rest
+}
+
+// callStart reports whether s starts a tool call, or might once more text arrives
+// JSON and code fences only count at the start of a line
+func callStart(s string, lineStart bool) (match, maybe bool) {
+	for _, m := range toolCallMarkers {
+		if strings.HasPrefix(s, m) {
+			return true, false
+		}
+		if len(s) < len(m) && strings.HasPrefix(m, s) {
+			maybe = true
+		}
+	}
+	if maybe || !lineStart {
+		return false, maybe
+	}
+
+	switch s[0] {
+	case '`':
+		return fenceStart(s)
+	case '{':
+		return objectStart(s)
+	case '[':
+		rest := strings.TrimLeft(s[1:], " \t\r\n")
+		if rest == "" {
+			return false, true
+		}
+		if rest[0] != '{' {
+			return false, false
+		}
+		return objectStart(rest)
+	}
+	return false, false
+}
+
+// fenceStart checks for a ```json fence holding a JSON object or array
+func fenceStart(s string) (match, maybe bool) {
+	if len(s) < 3 {
+		return false, strings.HasPrefix("```", s)
+	}
+	if !strings.HasPrefix(s, "```") {
+		return false, false
+	}
+	nl := strings.IndexByte(s, '\n')
+	if nl < 0 {
+		// Still reading the language
+		return false, len(s) < 20
+	}
+	if !fenceLanguages[strings.ToLower(strings.TrimSpace(s[3:nl]))] {
+		return false, false
+	}
+	rest := strings.TrimLeft(s[nl+1:], " \t\r\n")
+	if rest == "" {
+		return false, true
+	}
+	switch rest[0] {
+	case '{':
+		return objectStart(rest)
+	case '[':
+		return callStart(rest, true)
+	}
+	return false, false
+}
+
+// objectStart checks for a JSON object whose first key is one tool calls start with
+func objectStart(s string) (match, maybe bool) {
+	rest := strings.TrimLeft(s[1:], " \t\r\n")
+	if rest == "" {
+		return false, true
+	}
+	if rest[0] != '"' {
+		return false, false
+	}
+	end := strings.IndexByte(rest[1:], '"')
+	if end < 0 {
+		return false, len(rest) < 20
+	}
+	return toolCallKeys[rest[1:1+end]], false
+}
+
+// atLineStart reports whether only spaces precede position i on its line
+func atLineStart(content string, i int) bool {
+	lineStart := strings.LastIndexByte(content[:i], '\n') + 1
+	return strings.TrimLeft(content[lineStart:i], " \t") == ""
+}
+
+// inThinking reports whether text ends inside a <think> block
+func inThinking(text string) bool {
+	return strings.LastIndex(text, "<think>") > strings.LastIndex(text, "</think>")
+}
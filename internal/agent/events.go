@@ -0,0 +1,133 @@
+package agent
+
+import "github.com/DanielNikkari/maahinen/internal/llm"
+
+// Event is emitted by the agent while it processes a conversation turn
+type Event interface {
+	isEvent()
+}
+
+// Agent events
+type (
+	// StreamChunkEvent carries a chunk of streamed assistant text
+	// Done is set once the assistant message is complete
+	StreamChunkEvent struct {
+		Content string
+		Done    bool
+	}
+
+	// ToolCallPreparingEvent is emitted when streamed text starts a tool call written as text
+	// The rest of the message is held back until the call is complete
+	ToolCallPreparingEvent struct{}
+
+	// ToolCallEvent is emitted when the model requests a tool call and it is about to run
+	ToolCallEvent struct {
+		ID        string
+		Name      string
+		Arguments map[string]any
+	}
+
+	// ToolOutputEvent is emitted for each line of output a streaming tool prints while running
+	ToolOutputEvent struct {
+		ID   string
+		Name string
+		Line string
+	}
+
+	// ToolResultEvent is emitted when a tool call finishes
+	// Cancelled is set when the turn was cancelled while the tool was running
+	ToolResultEvent struct {
+		ID        string
+		Name      string
+		Arguments map[string]any
+		Success   bool
+		Cancelled bool
+		Output    string
+		Error     string
+	}
+
+	// ToolCancelledEvent is emitted when a tool call is denied
+	ToolCancelledEvent struct {
+		ID        string
+		Name      string
+		Arguments map[string]any
+	}
+
+	// TurnCancelledEvent is emitted when the turn was stopped with Cancel
+	TurnCancelledEvent struct{}
+
+	// ErrorEvent is emitted when the turn fails
+	ErrorEvent struct {
+		Err error
+	}
+
+	// ModelChangedEvent is emitted when the active model changes
+	ModelChangedEvent struct {
+		Model string
+	}
+
+	// OptionsChangedEvent is emitted when the generation options in effect change
+	OptionsChangedEvent struct {
+		Options llm.Options
+	}
+
+	// ContextCompactedEvent is emitted when older turns were replaced by a summary
+	// Before and After are the context sizes in tokens
+	ContextCompactedEvent struct {
+		Before int
+		After  int
+	}
+)
+
+func (StreamChunkEvent) isEvent()       {}
+func (ToolCallPreparingEvent) isEvent() {}
+func (ToolCallEvent) isEvent()          {}
+func (ToolOutputEvent) isEvent()        {}
+func (ToolResultEvent) isEvent()        {}
+func (ToolCancelledEvent) isEvent()     {}
+func (TurnCancelledEvent) isEvent()     {}
+func (ErrorEvent) isEvent()             {}
+func (ModelChangedEvent) isEvent()      {}
+func (OptionsChangedEvent) isEvent()    {}
+func (ContextCompactedEvent) isEvent()  {}
+
+// Sink receives events emitted by the agent
+type Sink interface {
+	Emit(Event)
+}
+
+// SinkFunc adapts a function to the Sink interface
+type SinkFunc func(Event)
+
+// Emit calls f(e)
+func (f SinkFunc) Emit(e Event) {
+	f(e)
+}
+
+// Confirmation is the user's answer to a tool confirmation request
+type Confirmation int
+
+const (
+	// ConfirmDeny skips the tool calls
+	ConfirmDeny Confirmation = iota
+	// ConfirmAllow runs the tool calls once
+	ConfirmAllow
+	// ConfirmAllowSession runs the tool calls and allows the same calls for the rest of the session
+	ConfirmAllowSession
+	// ConfirmAllowAlways runs the tool calls and saves rules allowing the same calls from now on
+	ConfirmAllowAlways
+)
+
+// Confirmer decides whether the tool calls requested in one model turn may run
+// The calls are approved or denied together
+type Confirmer interface {
+	ConfirmTools(calls []ToolCallEvent) Confirmation
+}
+
+// ConfirmFunc adapts a function to the Confirmer interface
+type ConfirmFunc func([]ToolCallEvent) Confirmation
+
+// ConfirmTools calls f(calls)
+func (f ConfirmFunc) ConfirmTools(calls []ToolCallEvent) Confirmation {
+	return f(calls)
+}
@@ -0,0 +1,381 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/DanielNikkari/maahinen/internal/llm"
+	"github.com/DanielNikkari/maahinen/internal/permission"
+	"github.com/DanielNikkari/maahinen/internal/tools"
+)
+
+// executeTools runs the tool calls requested in one model turn
+// The permission policy decides which calls run, are denied or need confirmation. Calls that
+// need it are confirmed together, consecutive read-only calls run concurrently and the
+// results are added to the conversation in the order the calls were made
+func (a *Agent) executeTools(ctx context.Context, calls []llm.ToolCall) error {
+	a.resolveToolNames(calls)
+	invalid := a.validateCalls(calls)
+	denied := a.checkPermissions(calls, invalid)
+
+	for i := 0; i < len(calls); {
+		if msg, ok := invalid[i]; ok {
+			a.rejectTool(calls[i], msg)
+			i++
+			continue
+		}
+		if reason, ok := denied[i]; ok {
+			a.denyTool(calls[i], reason)
+			i++
+			continue
+		}
+
+		end := i + 1
+		if a.isReadOnly(calls[i]) {
+			for end < len(calls) && a.isReadOnly(calls[end]) && !hasKey(denied, end) && !hasKey(invalid, end) {
+				end++
+			}
+		}
+
+		if err := a.runTools(ctx, calls[i:end]); err != nil {
+			for _, skipped := range calls[end:] {
+				a.denyTool(skipped, "Tool execution was skipped because an earlier tool call failed.")
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			// Every requested call still gets a result in the history
+			for _, skipped := range calls[end:] {
+				a.cancelTool(skipped)
+			}
+			return ctx.Err()
+		}
+		i = end
+	}
+	return nil
+}
+
+// resolveToolNames replaces tool names the model got wrong with the registered names
+// Each correction is written to the tool log with the model, to see which models misname tools
+func (a *Agent) resolveToolNames(calls []llm.ToolCall) {
+	for i, tc := range calls {
+		name, ok := a.tools.Resolve(tc.Function.Name)
+		if !ok || name == tc.Function.Name {
+			continue
+		}
+		a.logToolCall(tc.ID, name, nil, fmt.Sprintf("resolved from '%s' called by %s", tc.Function.Name, a.client.Model()))
+		calls[i].Function.Name = name
+	}
+}
+
+// validateCalls checks the arguments of each call against its tool's definition
+// Valid calls get their corrected arguments, the errors of invalid ones are returned keyed
+// by call index
+func (a *Agent) validateCalls(calls []llm.ToolCall) map[int]string {
+	invalid := map[int]string{}
+	for i, tc := range calls {
+		if tc.Function.ArgumentsError != "" {
+			if err := a.tools.DecodeError(tc.Function.Name, tc.Function.ArgumentsError); err != nil {
+				invalid[i] = err.Error()
+				continue
+			}
+		}
+		args, err := a.tools.Validate(tc.Function.Name, tc.Function.Arguments)
+		if err != nil {
+			invalid[i] = err.Error()
+			continue
+		}
+		calls[i].Function.Arguments = args
+	}
+	return invalid
+}
+
+// checkPermissions applies the permission policy to the calls of a turn and asks the user
+// to confirm the calls it doesn't decide, skipping the invalid ones
+// Returns the denial messages of the calls that must not run, keyed by call index
+func (a *Agent) checkPermissions(calls []llm.ToolCall, invalid map[int]string) map[int]string {
+	denied := map[int]string{}
+	var ask []int
+	for i, tc := range calls {
+		if hasKey(invalid, i) {
+			continue
+		}
+		call := toolCallEvent(tc)
+		action, rule, ok := a.policy.Check(call.Name, call.Arguments)
+		switch {
+		case !ok && a.autoConfirm:
+		case !ok, action == permission.Ask:
+			ask = append(ask, i)
+		case action == permission.Deny:
+			denied[i] = fmt.Sprintf("Tool execution was denied by the permission policy (rule: %s).", rule)
+		}
+	}
+	if len(ask) == 0 {
+		return denied
+	}
+
+	events := make([]ToolCallEvent, len(ask))
+	for i, idx := range ask {
+		events[i] = toolCallEvent(calls[idx])
+	}
+	answer := a.confirm(events)
+	if answer == ConfirmDeny {
+		for _, idx := range ask {
+			denied[idx] = "Tool execution was denied by the user."
+		}
+		return denied
+	}
+
+	if answer == ConfirmAllowSession || answer == ConfirmAllowAlways {
+		var rules []permission.Rule
+		for _, e := range events {
+			rules = append(rules, a.policy.AllowRules(e.Name, e.Arguments)...)
+		}
+		if answer == ConfirmAllowAlways {
+			if err := a.policy.Persist(rules); err != nil {
+				a.emit(ErrorEvent{Err: fmt.Errorf("could not save permission rules: %w", err)})
+			}
+		} else {
+			a.policy.AddSession(rules)
+		}
+	}
+	return denied
+}
+
+func hasKey(m map[int]string, k int) bool {
+	_, ok := m[k]
+	return ok
+}
+
+// runTools executes a batch of tool calls at the same time
+// Events and history entries are still produced in call order
+func (a *Agent) runTools(ctx context.Context, calls []llm.ToolCall) error {
+	type outcome struct {
+		result tools.Result
+		err    error
+	}
+	outcomes := make([]outcome, len(calls))
+
+	var wg sync.WaitGroup
+	for i, tc := range calls {
+		call := toolCallEvent(tc)
+		a.emit(call)
+		a.logToolCall(call.ID, call.Name, call.Arguments, "started")
+
+		tool, ok := a.tools.Get(call.Name)
+		if !ok {
+			// Reported by finishTool
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var result tools.Result
+			var err error
+			if st, ok := tool.(tools.StreamingTool); ok {
+				result, err = st.ExecuteStream(ctx, call.Arguments, func(line string) {
+					a.emit(ToolOutputEvent{ID: call.ID, Name: call.Name, Line: line})
+				})
+			} else {
+				result, err = tool.Execute(ctx, call.Arguments)
+			}
+			outcomes[i] = outcome{result: result, err: err}
+		}()
+	}
+	wg.Wait()
+
+	// Every call of the batch has run, so each gets its result even after an error
+	var firstErr error
+	for i, tc := range calls {
+		if err := a.finishTool(ctx, tc, outcomes[i].result, outcomes[i].err); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// finishTool reports the outcome of a tool call, logs it and adds the result to the conversation
+func (a *Agent) finishTool(ctx context.Context, tc llm.ToolCall, result tools.Result, err error) error {
+	toolName := tc.Function.Name
+	args := tc.Function.Arguments
+	toolID := tc.ID
+
+	if _, ok := a.tools.Get(toolName); !ok {
+		availableTools := strings.Join(a.tools.List(), ", ")
+		errMsg := fmt.Sprintf("Unknown tool '%s'. Available tools: %s", tc.Function.Name, availableTools)
+
+		a.emit(ToolResultEvent{
+			ID:        toolID,
+			Name:      toolName,
+			Arguments: args,
+			Success:   false,
+			Error:     errMsg,
+		})
+		a.logToolCall(toolID, toolName, nil, "error: unknown tool")
+		a.recordToolCall(toolID, toolName, args, "error", "", errMsg)
+
+		a.appendToolResult(tc, errMsg)
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		a.emit(ToolResultEvent{
+			ID:        toolID,
+			Name:      toolName,
+			Arguments: args,
+			Cancelled: true,
+			Output:    result.Output,
+			Error:     "cancelled by user",
+		})
+		a.logToolCall(toolID, toolName, nil, "cancelled by user")
+		a.recordToolCall(toolID, toolName, args, "cancelled", result.Output, "")
+
+		toolOutput := "Tool execution was cancelled by the user."
+		if result.Output != "" {
+			toolOutput += "\nOutput before cancellation: " + result.Output
+		}
+		a.appendToolResult(tc, toolOutput)
+		return nil
+	}
+	if err != nil {
+		a.emit(ToolResultEvent{
+			ID:        toolID,
+			Name:      toolName,
+			Arguments: args,
+			Success:   false,
+			Error:     err.Error(),
+		})
+		a.logToolCall(toolID, toolName, nil, fmt.Sprintf("execution error: %v", err))
+		a.recordToolCall(toolID, toolName, args, "error", "", err.Error())
+		a.appendToolResult(tc, fmt.Sprintf("Tool execution failed: %v", err))
+		return err
+	}
+
+	a.emit(ToolResultEvent{
+		ID:        toolID,
+		Name:      toolName,
+		Arguments: args,
+		Success:   result.Success,
+		Output:    result.Output,
+		Error:     result.Error,
+	})
+
+	// Log result
+	status := "success"
+	if !result.Success {
+		status = fmt.Sprintf("failed: %s", result.Error)
+	}
+	a.logToolCall(toolID, toolName, nil, status)
+
+	if result.Success {
+		a.recordToolCall(toolID, toolName, args, "success", result.Output, "")
+	} else {
+		a.recordToolCall(toolID, toolName, args, "error", result.Output, result.Error)
+	}
+
+	// Add tool result to messages
+	toolOutput := result.Output
+	if toolOutput == "" && result.Success {
+		toolOutput = "Command executed successfully (no output)"
+	} else if !result.Success {
+		toolOutput = fmt.Sprintf("Command failed: %s\nOutput: %s", result.Error, result.Output)
+	}
+
+	a.appendToolResult(tc, toolOutput)
+
+	return nil
+}
+
+// denyTool records a tool call that was not allowed to run
+func (a *Agent) denyTool(tc llm.ToolCall, reason string) {
+	call := toolCallEvent(tc)
+
+	a.logToolCall(call.ID, call.Name, call.Arguments, reason)
+	a.recordToolCall(call.ID, call.Name, call.Arguments, "cancelled", "", "")
+	a.emit(ToolCancelledEvent(call))
+	// Add denial message to conversation
+	a.appendToolResult(tc, reason)
+}
+
+// rejectTool records a tool call whose arguments don't fit the tool
+// The model gets the validation error so it can correct the call
+func (a *Agent) rejectTool(tc llm.ToolCall, msg string) {
+	call := toolCallEvent(tc)
+
+	a.emit(call)
+	a.emit(ToolResultEvent{
+		ID:        call.ID,
+		Name:      call.Name,
+		Arguments: call.Arguments,
+		Success:   false,
+		Error:     msg,
+	})
+	a.logToolCall(call.ID, call.Name, call.Arguments, "error: invalid arguments")
+	a.recordToolCall(call.ID, call.Name, call.Arguments, "error", "", msg)
+	a.appendToolResult(tc, msg)
+}
+
+// cancelTool records a tool call that was skipped because the turn was cancelled
+func (a *Agent) cancelTool(tc llm.ToolCall) {
+	call := toolCallEvent(tc)
+
+	a.logToolCall(call.ID, call.Name, call.Arguments, "cancelled by user")
+	a.recordToolCall(call.ID, call.Name, call.Arguments, "cancelled", "", "")
+	a.emit(ToolCancelledEvent(call))
+	a.appendToolResult(tc, "Tool execution was cancelled by the user.")
+}
+
+// isReadOnly reports whether a call targets a tool without side effects
+func (a *Agent) isReadOnly(tc llm.ToolCall) bool {
+	tool, ok := a.tools.Get(tc.Function.Name)
+	return ok && tools.IsReadOnly(tool)
+}
+
+// confirm asks the confirmer whether the tool calls of a turn may run
+// Without a confirmer every call is denied
+func (a *Agent) confirm(calls []ToolCallEvent) Confirmation {
+	if a.confirmer == nil {
+		return ConfirmDeny
+	}
+	return a.confirmer.ConfirmTools(calls)
+}
+
+// appendToolResult adds the result of a tool call to the conversation
+func (a *Agent) appendToolResult(tc llm.ToolCall, content string) {
+	a.messages = append(a.messages, llm.Message{
+		Role:       llm.RoleTool,
+		Content:    content,
+		ToolCallID: tc.ID,
+		ToolName:   tc.Function.Name,
+	})
+}
+
+// toolCallEvent describes a tool call
+func toolCallEvent(tc llm.ToolCall) ToolCallEvent {
+	return ToolCallEvent{
+		ID:        tc.ID,
+		Name:      tc.Function.Name,
+		Arguments: tc.Function.Arguments,
+	}
+}
+
+// assignToolCallIDs generates IDs for tool calls the backend did not identify
+func assignToolCallIDs(calls []llm.ToolCall) {
+	for i := range calls {
+		if calls[i].ID == "" {
+			calls[i].ID = newToolCallID()
+		}
+	}
+}
+
+// newToolCallID generates a unique tool call ID
+func newToolCallID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return "call_" + hex.EncodeToString(b)
+}
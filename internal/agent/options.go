@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"github.com/DanielNikkari/maahinen/internal/llm"
+)
+
+// Options returns the generation options in effect for the active model
+func (a *Agent) Options() llm.Options {
+	return a.client.Options()
+}
+
+// SetOption overrides a generation option for the current session
+// The value "default" removes the override
+func (a *Agent) SetOption(name, value string) error {
+	options := a.sessionOptions
+	if err := options.Set(name, value); err != nil {
+		return err
+	}
+	a.sessionOptions = options
+	a.applyOptions()
+	return nil
+}
+
+// applyOptions combines the configured options, the active model's overrides and
+// the session overrides and sends them with subsequent requests
+func (a *Agent) applyOptions() {
+	var options llm.Options
+	// The options block lives in the Ollama config, other providers only use session overrides
+	if a.client.Provider() == llm.ProviderOllama {
+		options = a.ollama.OptionsFor(a.client.Model())
+	}
+	options = options.Merge(a.sessionOptions)
+
+	a.client.SetOptions(options)
+	a.emit(OptionsChangedEvent{Options: options})
+}
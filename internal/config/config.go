@@ -5,20 +5,93 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/DanielNikkari/maahinen/internal/llm"
+	"github.com/DanielNikkari/maahinen/internal/mcp"
+	"github.com/DanielNikkari/maahinen/internal/permission"
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Agent  AgentConfig  `yaml:"agent"`
-	UI     UIConfig     `yaml:"ui"`
-	Ollama OllamaConfig `yaml:"ollama"`
+	// Provider selects the model server protocol: "ollama" or "openai"
+	Provider  string          `yaml:"provider"`
+	Agent     AgentConfig     `yaml:"agent"`
+	Workspace WorkspaceConfig `yaml:"workspace"`
+	Bash      BashConfig      `yaml:"bash"`
+	Tools     ToolsConfig     `yaml:"tools"`
+	MCP       MCPConfig       `yaml:"mcp"`
+	// Permissions are rules deciding which tool calls run, need confirmation or are denied
+	Permissions []permission.Rule `yaml:"permissions"`
+	Sandbox     SandboxConfig     `yaml:"sandbox"`
+	UI          UIConfig          `yaml:"ui"`
+	Ollama      OllamaConfig      `yaml:"ollama"`
+	OpenAI      OpenAIConfig      `yaml:"openai"`
 }
 
 // AgentConfig contains agent-related configuration
 type AgentConfig struct {
-	SystemPrompt string `yaml:"system_prompt"`
-	AutoConfirm  bool   `yaml:"auto_confirm"`
+	SystemPrompt string           `yaml:"system_prompt"`
+	AutoConfirm  bool             `yaml:"auto_confirm"`
+	Compaction   CompactionConfig `yaml:"compaction"`
+}
+
+// CompactionConfig contains settings for automatic context compaction
+type CompactionConfig struct {
+	// Enabled turns automatic compaction on or off (/compact always works)
+	Enabled bool `yaml:"enabled"`
+	// Threshold is the fraction of the context window that triggers compaction
+	Threshold float64 `yaml:"threshold"`
+	// KeepRecentTurns is the number of most recent user turns kept verbatim
+	KeepRecentTurns int `yaml:"keep_recent_turns"`
+	// ContextWindow is the model's context size in tokens (num_ctx)
+	ContextWindow int `yaml:"context_window"`
+}
+
+// WorkspaceConfig controls which files the file tools can access
+type WorkspaceConfig struct {
+	// Root is the directory file tools are confined to, defaults to the launch directory
+	Root string `yaml:"root"`
+	// Allow lists paths or glob patterns outside the root that the tools may still access
+	Allow []string `yaml:"allow"`
+}
+
+// BashConfig controls how bash commands run
+type BashConfig struct {
+	// Timeout is the default command timeout in seconds
+	Timeout int `yaml:"timeout"`
+	// MaxTimeout is the longest timeout in seconds the model can ask for
+	MaxTimeout int `yaml:"max_timeout"`
+	// MaxOutput is how many characters of output are returned to the model, 0 for no limit
+	MaxOutput int `yaml:"max_output"`
+}
+
+// ToolsConfig contains settings shared by all tools
+type ToolsConfig struct {
+	// Aliases maps other names models call tools by to the tool names
+	Aliases map[string]string `yaml:"aliases"`
+}
+
+// MCPConfig lists the Model Context Protocol servers whose tools the agent can use
+type MCPConfig struct {
+	// Servers are keyed by name, their tools are registered as <name>__<tool>
+	Servers map[string]mcp.ServerConfig `yaml:"servers"`
+}
+
+// SandboxConfig controls the sandbox bash commands run in (Linux only)
+type SandboxConfig struct {
+	// Enabled runs bash commands with only the workspace writable
+	Enabled bool `yaml:"enabled"`
+	// Network allows network access inside the sandbox
+	Network bool `yaml:"network"`
+	// Writable lists extra directories commands may write to
+	Writable []string `yaml:"writable"`
+	// CPUSeconds limits the CPU time of each command, 0 for no limit
+	CPUSeconds int `yaml:"cpu_seconds"`
+	// MemoryMB limits the virtual memory of each process, 0 for no limit
+	MemoryMB int `yaml:"memory_mb"`
+	// MaxProcesses limits the number of processes, 0 for no limit. The kernel counts every
+	// process of the user, not only the sandbox's, so it is off by default
+	MaxProcesses int `yaml:"max_processes"`
 }
 
 // UIConfig contains UI-related configuration
@@ -31,11 +104,30 @@ type UIConfig struct {
 type OllamaConfig struct {
 	BaseURL      string `yaml:"base_url"`
 	DefaultModel string `yaml:"default_model"`
+	// Options are generation options sent with every request
+	Options llm.Options `yaml:"options"`
+	// Models holds per-model option overrides keyed by model name
+	Models map[string]llm.Options `yaml:"models"`
+}
+
+// OptionsFor returns the generation options for a model, with its overrides applied
+func (c OllamaConfig) OptionsFor(model string) llm.Options {
+	return c.Options.Merge(c.Models[model])
+}
+
+// OpenAIConfig contains settings for OpenAI-compatible servers
+// (llama.cpp's llama-server, vLLM, LM Studio, ...)
+type OpenAIConfig struct {
+	// BaseURL is the API root including the version, e.g. http://localhost:8080/v1
+	BaseURL      string `yaml:"base_url"`
+	APIKey       string `yaml:"api_key"`
+	DefaultModel string `yaml:"default_model"`
 }
 
 // DefaultConfig returns the default configuration
 func DefaultConfig() *Config {
 	return &Config{
+		Provider: "ollama",
 		Agent: AgentConfig{
 			SystemPrompt: `You are Maahinen, a helpful coding assistant. You help users with programming tasks,
 answer questions about code, and assist with debugging. Be concise and practical.
@@ -44,6 +136,21 @@ you should utilize your tools to complete the user request. If a tool call fails
 corrected arguments. In case you run into a problem, try to iterate on the issue before returning a final response. However, if the issue
 is not fixed in reasonable amount of tries, let the user know there is an issue.`,
 			AutoConfirm: false,
+			Compaction: CompactionConfig{
+				Enabled:         true,
+				Threshold:       0.8,
+				KeepRecentTurns: 2,
+				ContextWindow:   4096,
+			},
+		},
+		Bash: BashConfig{
+			Timeout:    30,
+			MaxTimeout: 600,
+			MaxOutput:  30000,
+		},
+		Sandbox: SandboxConfig{
+			CPUSeconds: 300,
+			MemoryMB:   4096,
 		},
 		UI: UIConfig{
 			SpinnerStyle:  "dots",
@@ -53,6 +160,9 @@ is not fixed in reasonable amount of tries, let the user know there is an issue.
 			BaseURL:      "http://localhost:11434",
 			DefaultModel: "qwen2.5-coder:7b",
 		},
+		OpenAI: OpenAIConfig{
+			BaseURL: "http://localhost:8080/v1",
+		},
 	}
 }
 
@@ -79,6 +189,23 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
+	switch cfg.Provider {
+	case "ollama", "openai":
+	default:
+		return nil, fmt.Errorf("unknown provider '%s' (expected ollama or openai)", cfg.Provider)
+	}
+	if cfg.Bash.Timeout <= 0 || cfg.Bash.MaxTimeout < cfg.Bash.Timeout {
+		return nil, fmt.Errorf("bash.timeout must be positive and at most bash.max_timeout")
+	}
+	if err := permission.Validate(cfg.Permissions); err != nil {
+		return nil, err
+	}
+	for name, server := range cfg.MCP.Servers {
+		if server.Command == "" {
+			return nil, fmt.Errorf("mcp server '%s' has no command", name)
+		}
+	}
+
 	return cfg, nil
 }
 
@@ -0,0 +1,164 @@
+package headless
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/DanielNikkari/maahinen/internal/agent"
+	"github.com/DanielNikkari/maahinen/internal/config"
+	"github.com/DanielNikkari/maahinen/internal/llm"
+	"github.com/DanielNikkari/maahinen/internal/session"
+	"github.com/DanielNikkari/maahinen/internal/tools"
+)
+
+// Runner adapts the agent to a plain terminal without the TUI
+// Assistant text is streamed to stdout, tool activity is reported on stderr
+type Runner struct {
+	agent  *agent.Agent
+	stdout io.Writer
+	stderr io.Writer
+
+	// Whether the last text written to stdout ended a line
+	atLineStart bool
+
+	// Number of tool calls that failed during the run
+	failedTools int
+}
+
+// NewRunner creates a new headless runner
+func NewRunner(client *llm.Client, registry *tools.Registry, cfg *config.Config) *Runner {
+	r := &Runner{
+		agent:       agent.New(client, registry, cfg),
+		stdout:      os.Stdout,
+		stderr:      os.Stderr,
+		atLineStart: true,
+	}
+	r.agent.SetSink(agent.SinkFunc(r.handleEvent))
+	r.agent.SetConfirmer(agent.ConfirmFunc(r.confirm))
+	return r
+}
+
+// SetAutoConfirm sets whether tools should be auto-confirmed
+func (r *Runner) SetAutoConfirm(auto bool) {
+	r.agent.SetAutoConfirm(auto)
+}
+
+// SetSessionStore enables saving the run as a session in the given store
+func (r *Runner) SetSessionStore(store *session.Store) {
+	r.agent.SetSessionStore(store)
+}
+
+// ResumeSession continues a stored session instead of starting a new one
+func (r *Runner) ResumeSession(s *session.Session) {
+	r.agent.ResumeSession(s)
+}
+
+// Run sends the prompt to the model and processes tool calls until the model
+// gives a final answer. An error is returned if the model or any tool fails.
+// Cancelling ctx stops the run and returns context.Canceled
+func (r *Runner) Run(ctx context.Context, prompt string) error {
+	defer r.agent.Close()
+
+	err := r.agent.Run(ctx, prompt)
+	r.endLine()
+	if err != nil {
+		return err
+	}
+
+	if r.failedTools > 0 {
+		return fmt.Errorf("%d tool call(s) failed", r.failedTools)
+	}
+	return nil
+}
+
+// handleEvent prints agent events to stdout and stderr
+func (r *Runner) handleEvent(e agent.Event) {
+	switch e := e.(type) {
+	case agent.StreamChunkEvent:
+		if e.Content != "" {
+			fmt.Fprint(r.stdout, e.Content)
+			r.atLineStart = strings.HasSuffix(e.Content, "\n")
+		}
+		if e.Done {
+			r.endLine()
+		}
+	case agent.ToolCallEvent:
+		fmt.Fprintf(r.stderr, "⚡ %s(%s)\n", e.Name, formatArgs(e.Arguments))
+	case agent.ToolResultEvent:
+		if !e.Success {
+			fmt.Fprintf(r.stderr, "  %s failed: %s\n", e.Name, e.Error)
+			r.failedTools++
+		}
+	case agent.ToolCancelledEvent:
+		fmt.Fprintf(r.stderr, "⚡ %s(%s) - cancelled\n", e.Name, formatArgs(e.Arguments))
+		r.failedTools++
+	case agent.ContextCompactedEvent:
+		fmt.Fprintf(r.stderr, "Context compacted: ~%d → ~%d tokens\n", e.Before, e.After)
+	}
+}
+
+// endLine terminates a partially written stdout line
+func (r *Runner) endLine() {
+	if !r.atLineStart {
+		fmt.Fprintln(r.stdout)
+		r.atLineStart = true
+	}
+}
+
+// confirm asks the user on the controlling terminal whether to run the tool calls of a turn
+// If there is no terminal to ask on, the tool calls are denied
+func (r *Runner) confirm(calls []agent.ToolCallEvent) agent.Confirmation {
+	names := make([]string, len(calls))
+	for i, call := range calls {
+		names[i] = call.Name
+	}
+
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		if r.agent.AutoConfirm() {
+			fmt.Fprintf(r.stderr, "no terminal available to confirm %s, which an ask permission rule requires\n", strings.Join(names, ", "))
+		} else {
+			fmt.Fprintf(r.stderr, "no terminal available to confirm %s, use --yes to auto-confirm tools\n", strings.Join(names, ", "))
+		}
+		return agent.ConfirmDeny
+	}
+	defer tty.Close()
+
+	r.endLine()
+	if len(calls) == 1 {
+		fmt.Fprintf(r.stderr, "Run %s(%s)? [y/N/a=always this session/s=always, save rule]: ", calls[0].Name, formatArgs(calls[0].Arguments))
+	} else {
+		fmt.Fprintf(r.stderr, "Run %d tool calls?\n", len(calls))
+		for _, call := range calls {
+			fmt.Fprintf(r.stderr, "  %s(%s)\n", call.Name, formatArgs(call.Arguments))
+		}
+		fmt.Fprint(r.stderr, "[y/N/a=always this session/s=always, save rule]: ")
+	}
+	answer, _ := bufio.NewReader(tty).ReadString('\n')
+	switch strings.TrimSpace(strings.ToLower(answer)) {
+	case "y", "yes":
+		return agent.ConfirmAllow
+	case "a", "always":
+		return agent.ConfirmAllowSession
+	case "s", "save":
+		return agent.ConfirmAllowAlways
+	}
+	return agent.ConfirmDeny
+}
+
+// formatArgs formats tool arguments as a short one-liner
+func formatArgs(args map[string]any) string {
+	var parts []string
+	for k, v := range args {
+		s := strings.ReplaceAll(fmt.Sprintf("%s=%v", k, v), "\n", " ")
+		if len(s) > 60 {
+			s = s[:57] + "..."
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, ", ")
+}
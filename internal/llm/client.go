@@ -1,29 +1,29 @@
 package llm
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"time"
+	"context"
 )
 
+// Client sends chat requests for the active model through a Provider
 type Client struct {
-	baseURL    string
-	model      string
-	tools      []Tool
-	httpClient *http.Client
+	provider  Provider
+	model     string
+	tools     []Tool
+	options   Options
+	lastUsage Usage
 }
 
+// NewClient creates a client for the Ollama server at baseURL
 func NewClient(baseURL, model string) *Client {
+	return NewClientWithProvider(NewOllamaProvider(baseURL), model)
+}
+
+// NewClientWithProvider creates a client that talks to the given provider
+func NewClientWithProvider(provider Provider, model string) *Client {
 	return &Client{
-		baseURL: baseURL,
-		model:   model,
-		tools:   []Tool{},
-		httpClient: &http.Client{
-			Timeout: 5 * time.Minute,
-		},
+		provider: provider,
+		model:    model,
+		tools:    []Tool{},
 	}
 }
 
@@ -31,39 +31,22 @@ func (c *Client) RegisterTool(tool Tool) {
 	c.tools = append(c.tools, tool)
 }
 
-func (c *Client) Chat(messages []Message) (*Message, error) {
-	req := ChatRequest{
-		Model:    c.model,
-		Messages: messages,
-		Tools:    c.tools,
-		Stream:   false,
-	}
+func (c *Client) Chat(ctx context.Context, messages []Message) (*Message, error) {
+	return c.chat(ctx, messages, c.tools)
+}
 
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to Marshal the request: %w", err)
-	}
+// ChatPlain sends a non-streaming chat request without any tool definitions
+func (c *Client) ChatPlain(ctx context.Context, messages []Message) (*Message, error) {
+	return c.chat(ctx, messages, nil)
+}
 
-	resp, err := c.httpClient.Post(
-		c.baseURL+"/api/chat",
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
+func (c *Client) chat(ctx context.Context, messages []Message, tools []Tool) (*Message, error) {
+	msg, usage, err := c.provider.Chat(ctx, c.request(messages, tools))
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
-	}
-
-	var chatResp ChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	return &chatResp.Message, nil
+	c.lastUsage = usage
+	return msg, nil
 }
 
 func (m *Message) HasToolCalls() bool {
@@ -79,7 +62,32 @@ func (c *Client) SetModel(model string) {
 }
 
 func (c *Client) BaseURL() string {
-	return c.baseURL
+	return c.provider.BaseURL()
+}
+
+// Options returns the generation options sent with each request
+func (c *Client) Options() Options {
+	return c.options
+}
+
+// SetOptions sets the generation options sent with each request
+func (c *Client) SetOptions(options Options) {
+	c.options = options
+}
+
+// Provider returns the name of the provider the client talks to
+func (c *Client) Provider() string {
+	return c.provider.Name()
+}
+
+// ListModels returns the names of the models available on the server
+func (c *Client) ListModels(ctx context.Context) ([]string, error) {
+	return c.provider.ListModels(ctx)
+}
+
+// LastUsage returns the token counts reported for the most recent request
+func (c *Client) LastUsage() Usage {
+	return c.lastUsage
 }
 
 // StreamCallback is called for each chunk of a streaming response
@@ -87,79 +95,25 @@ type StreamCallback func(chunk string, done bool, fullMessage *Message)
 
 // ChatStream sends a chat request with streaming enabled
 // The callback is called for each chunk received
-// Returns the final complete message
-func (c *Client) ChatStream(messages []Message, callback StreamCallback) (*Message, error) {
+// Returns the final complete message. If the stream is interrupted, the message
+// received so far is returned along with the error
+func (c *Client) ChatStream(ctx context.Context, messages []Message, callback StreamCallback) (*Message, error) {
+	msg, usage, err := c.provider.ChatStream(ctx, c.request(messages, c.tools), callback)
+	c.lastUsage = usage
+	return msg, err
+}
+
+// request builds a chat request for the active model
+func (c *Client) request(messages []Message, tools []Tool) ChatRequest {
 	req := ChatRequest{
 		Model:    c.model,
 		Messages: messages,
-		Tools:    c.tools,
-		Stream:   true,
+		Tools:    tools,
 	}
-
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	if !c.options.IsZero() {
+		options := c.options
+		req.Options = &options
+		req.KeepAlive = options.keepAliveValue()
 	}
-
-	resp, err := c.httpClient.Post(
-		c.baseURL+"/api/chat",
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
-	}
-
-	var fullMessage Message
-	fullMessage.Role = RoleAssistant
-
-	scanner := bufio.NewScanner(resp.Body)
-	// Increase buffer size for potentially large responses
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 1024*1024)
-
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
-		}
-
-		var streamResp ChatResponse
-		if err := json.Unmarshal(line, &streamResp); err != nil {
-			// Skip malformed lines
-			continue
-		}
-
-		// Accumulate content
-		if streamResp.Message.Content != "" {
-			fullMessage.Content += streamResp.Message.Content
-			if callback != nil {
-				callback(streamResp.Message.Content, false, nil)
-			}
-		}
-
-		// Check for tool calls (usually comes at the end)
-		if len(streamResp.Message.ToolCalls) > 0 {
-			fullMessage.ToolCalls = streamResp.Message.ToolCalls
-		}
-
-		// Final message
-		if streamResp.Done {
-			if callback != nil {
-				callback("", true, &fullMessage)
-			}
-			break
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading stream: %w", err)
-	}
-
-	return &fullMessage, nil
+	return req
 }
@@ -0,0 +1,168 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OllamaProvider talks to Ollama's /api/chat endpoint
+type OllamaProvider struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewOllamaProvider creates a provider for the Ollama server at baseURL
+func NewOllamaProvider(baseURL string) *OllamaProvider {
+	return &OllamaProvider{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: newHTTPClient(),
+	}
+}
+
+func (p *OllamaProvider) Name() string {
+	return ProviderOllama
+}
+
+func (p *OllamaProvider) BaseURL() string {
+	return p.baseURL
+}
+
+func (p *OllamaProvider) Chat(ctx context.Context, req ChatRequest) (*Message, Usage, error) {
+	req.Stream = false
+
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, Usage{}, fmt.Errorf("failed to Marshal the request: %w", err)
+	}
+
+	resp, err := doRequest(ctx, p.httpClient, p.baseURL+"/api/chat", jsonData, nil)
+	if err != nil {
+		return nil, Usage{}, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, Usage{}, statusError(resp)
+	}
+
+	var chatResp ChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return nil, Usage{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	usage := Usage{
+		PromptTokens:     chatResp.PromptEvalCount,
+		CompletionTokens: chatResp.EvalCount,
+	}
+	return &chatResp.Message, usage, nil
+}
+
+func (p *OllamaProvider) ChatStream(ctx context.Context, req ChatRequest, callback StreamCallback) (*Message, Usage, error) {
+	req.Stream = true
+
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, Usage{}, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := doRequest(ctx, p.httpClient, p.baseURL+"/api/chat", jsonData, nil)
+	if err != nil {
+		return nil, Usage{}, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, Usage{}, statusError(resp)
+	}
+
+	var fullMessage Message
+	fullMessage.Role = RoleAssistant
+	var usage Usage
+
+	scanner := bufio.NewScanner(resp.Body)
+	// Increase buffer size for potentially large responses
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var streamResp ChatResponse
+		if err := json.Unmarshal(line, &streamResp); err != nil {
+			// Skip malformed lines
+			continue
+		}
+
+		// Accumulate content
+		if streamResp.Message.Content != "" {
+			fullMessage.Content += streamResp.Message.Content
+			if callback != nil {
+				callback(streamResp.Message.Content, false, nil)
+			}
+		}
+
+		// Tool calls usually come at the end, possibly spread over several chunks
+		if len(streamResp.Message.ToolCalls) > 0 {
+			fullMessage.ToolCalls = append(fullMessage.ToolCalls, streamResp.Message.ToolCalls...)
+		}
+
+		// Final message
+		if streamResp.Done {
+			// Token counts are only reported in the final chunk
+			usage = Usage{
+				PromptTokens:     streamResp.PromptEvalCount,
+				CompletionTokens: streamResp.EvalCount,
+			}
+
+			if callback != nil {
+				callback("", true, &fullMessage)
+			}
+			break
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return &fullMessage, usage, fmt.Errorf("error reading stream: %w", err)
+	}
+
+	// The server may close the stream early when the request is cancelled
+	if err := ctx.Err(); err != nil {
+		return &fullMessage, usage, err
+	}
+
+	return &fullMessage, usage, nil
+}
+
+func (p *OllamaProvider) ListModels(ctx context.Context) ([]string, error) {
+	resp, err := doRequest(ctx, p.httpClient, p.baseURL+"/api/tags", nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+
+	var list struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	names := make([]string, 0, len(list.Models))
+	for _, m := range list.Models {
+		names = append(names, m.Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,400 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OpenAIProvider talks to an OpenAI-compatible /chat/completions endpoint
+// as served by llama.cpp's llama-server, vLLM, LM Studio and others
+type OpenAIProvider struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewOpenAIProvider creates a provider for the server at baseURL (e.g. http://localhost:8080/v1)
+// apiKey is sent as a bearer token when set
+func NewOpenAIProvider(baseURL, apiKey string) *OpenAIProvider {
+	return &OpenAIProvider{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: newHTTPClient(),
+	}
+}
+
+// OpenAI wire format
+type (
+	openAIRequest struct {
+		Model         string               `json:"model"`
+		Messages      []openAIMessage      `json:"messages"`
+		Tools         []Tool               `json:"tools,omitempty"`
+		Stream        bool                 `json:"stream"`
+		StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+		Temperature   *float64             `json:"temperature,omitempty"`
+		TopP          *float64             `json:"top_p,omitempty"`
+		Seed          *int                 `json:"seed,omitempty"`
+		Stop          []string             `json:"stop,omitempty"`
+	}
+
+	openAIStreamOptions struct {
+		IncludeUsage bool `json:"include_usage"`
+	}
+
+	openAIMessage struct {
+		Role       string           `json:"role,omitempty"`
+		Content    string           `json:"content"`
+		ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+		ToolCallID string           `json:"tool_call_id,omitempty"`
+	}
+
+	openAIToolCall struct {
+		// Index identifies the call a streamed fragment belongs to
+		Index    *int           `json:"index,omitempty"`
+		ID       string         `json:"id,omitempty"`
+		Type     string         `json:"type,omitempty"`
+		Function openAIFunction `json:"function"`
+	}
+
+	openAIFunction struct {
+		Name string `json:"name,omitempty"`
+		// Arguments is a JSON-encoded string, some servers send a plain object instead
+		Arguments json.RawMessage `json:"arguments,omitempty"`
+	}
+
+	openAIResponse struct {
+		Choices []struct {
+			Message openAIMessage `json:"message"`
+			Delta   openAIMessage `json:"delta"`
+		} `json:"choices"`
+		Usage *struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+)
+
+func (p *OpenAIProvider) Name() string {
+	return ProviderOpenAI
+}
+
+func (p *OpenAIProvider) BaseURL() string {
+	return p.baseURL
+}
+
+func (p *OpenAIProvider) Chat(ctx context.Context, req ChatRequest) (*Message, Usage, error) {
+	resp, err := p.send(ctx, req, false)
+	if err != nil {
+		return nil, Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	var chatResp openAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return nil, Usage{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(chatResp.Choices) == 0 {
+		return nil, Usage{}, fmt.Errorf("response contains no choices")
+	}
+
+	var usage Usage
+	if chatResp.Usage != nil {
+		usage = Usage{
+			PromptTokens:     chatResp.Usage.PromptTokens,
+			CompletionTokens: chatResp.Usage.CompletionTokens,
+		}
+	}
+
+	msg := chatResp.Choices[0].Message
+	message := &Message{
+		Role:    RoleAssistant,
+		Content: msg.Content,
+	}
+	for _, tc := range msg.ToolCalls {
+		message.ToolCalls = append(message.ToolCalls, ToolCall{
+			ID:       tc.ID,
+			Function: toolFunction(tc.Function.Name, decodeArguments(tc.Function.Arguments)),
+		})
+	}
+	return message, usage, nil
+}
+
+func (p *OpenAIProvider) ChatStream(ctx context.Context, req ChatRequest, callback StreamCallback) (*Message, Usage, error) {
+	resp, err := p.send(ctx, req, true)
+	if err != nil {
+		return nil, Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	var fullMessage Message
+	fullMessage.Role = RoleAssistant
+	var usage Usage
+
+	// Tool calls arrive in fragments keyed by index, arguments are streamed as partial strings
+	type partialCall struct {
+		id   string
+		name string
+		args strings.Builder
+	}
+	var calls []*partialCall
+	callsByIndex := map[int]*partialCall{}
+
+	scanner := bufio.NewScanner(resp.Body)
+	// Increase buffer size for potentially large responses
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		// Only data lines carry chunks, skip blank lines, comments and event names
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			continue
+		}
+		data = bytes.TrimSpace(data)
+		if string(data) == "[DONE]" {
+			break
+		}
+
+		var chunk openAIResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			// Skip malformed lines
+			continue
+		}
+
+		// Token counts are reported in a final chunk without choices
+		if chunk.Usage != nil {
+			usage = Usage{
+				PromptTokens:     chunk.Usage.PromptTokens,
+				CompletionTokens: chunk.Usage.CompletionTokens,
+			}
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				fullMessage.Content += choice.Delta.Content
+				if callback != nil {
+					callback(choice.Delta.Content, false, nil)
+				}
+			}
+
+			for i, tc := range choice.Delta.ToolCalls {
+				index := i
+				if tc.Index != nil {
+					index = *tc.Index
+				}
+				call, ok := callsByIndex[index]
+				if !ok {
+					call = &partialCall{}
+					callsByIndex[index] = call
+					calls = append(calls, call)
+				}
+				if tc.ID != "" {
+					call.id = tc.ID
+				}
+				if tc.Function.Name != "" {
+					call.name = tc.Function.Name
+				}
+				call.args.WriteString(decodeArguments(tc.Function.Arguments))
+			}
+		}
+	}
+
+	for _, call := range calls {
+		fullMessage.ToolCalls = append(fullMessage.ToolCalls, ToolCall{
+			ID:       call.id,
+			Function: toolFunction(call.name, call.args.String()),
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return &fullMessage, usage, fmt.Errorf("error reading stream: %w", err)
+	}
+
+	// The server may close the stream early when the request is cancelled
+	if err := ctx.Err(); err != nil {
+		return &fullMessage, usage, err
+	}
+
+	if callback != nil {
+		callback("", true, &fullMessage)
+	}
+
+	return &fullMessage, usage, nil
+}
+
+func (p *OpenAIProvider) ListModels(ctx context.Context) ([]string, error) {
+	resp, err := doRequest(ctx, p.httpClient, p.baseURL+"/models", nil, p.header())
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	names := make([]string, 0, len(list.Data))
+	for _, m := range list.Data {
+		names = append(names, m.ID)
+	}
+	return names, nil
+}
+
+// send posts a chat completion request and checks the response status
+func (p *OpenAIProvider) send(ctx context.Context, req ChatRequest, stream bool) (*http.Response, error) {
+	body := openAIRequest{
+		Model:    req.Model,
+		Messages: toOpenAIMessages(req.Messages),
+		Tools:    req.Tools,
+		Stream:   stream,
+	}
+	// num_ctx and keep_alive are Ollama-specific, the context size is set when the server starts
+	if req.Options != nil {
+		body.Temperature = req.Options.Temperature
+		body.TopP = req.Options.TopP
+		body.Seed = req.Options.Seed
+		body.Stop = req.Options.Stop
+	}
+	if stream {
+		// Ask for token counts, servers that don't support usage reporting ignore this
+		body.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := doRequest(ctx, p.httpClient, p.baseURL+"/chat/completions", jsonData, p.header())
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, statusError(resp)
+	}
+	return resp, nil
+}
+
+// header returns the headers sent with every request
+func (p *OpenAIProvider) header() http.Header {
+	header := http.Header{}
+	if p.apiKey != "" {
+		header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	return header
+}
+
+// toOpenAIMessages converts the conversation to the OpenAI message format
+// Every tool result must reference the ID of the call it answers. Calls without an ID get one
+// generated, and results without an ID are paired with the unanswered calls in order.
+func toOpenAIMessages(messages []Message) []openAIMessage {
+	result := make([]openAIMessage, 0, len(messages))
+	var pending []string
+
+	for i, m := range messages {
+		om := openAIMessage{
+			Role:    m.Role,
+			Content: m.Content,
+		}
+
+		if len(m.ToolCalls) > 0 {
+			pending = pending[:0]
+			for j, tc := range m.ToolCalls {
+				id := tc.ID
+				if id == "" {
+					id = fmt.Sprintf("call_%d_%d", i, j)
+				}
+				args := tc.Function.Arguments
+				if args == nil {
+					args = map[string]any{}
+				}
+				argsJSON, _ := json.Marshal(args)
+				encoded, _ := json.Marshal(string(argsJSON))
+
+				om.ToolCalls = append(om.ToolCalls, openAIToolCall{
+					ID:   id,
+					Type: "function",
+					Function: openAIFunction{
+						Name:      tc.Function.Name,
+						Arguments: encoded,
+					},
+				})
+				pending = append(pending, id)
+			}
+		}
+
+		if m.Role == RoleTool {
+			om.ToolCallID = m.ToolCallID
+			if om.ToolCallID == "" && len(pending) > 0 {
+				om.ToolCallID = pending[0]
+			}
+			for j, id := range pending {
+				if id == om.ToolCallID {
+					pending = append(pending[:j], pending[j+1:]...)
+					break
+				}
+			}
+		}
+
+		result = append(result, om)
+	}
+	return result
+}
+
+// decodeArguments returns the arguments JSON carried by a tool call
+// The OpenAI format encodes it as a string, but a plain object is accepted as well
+func decodeArguments(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// Longest part of undecodable arguments quoted back to the model
+const maxQuotedArguments = 500
+
+// toolFunction builds a called function, keeping why its arguments couldn't be decoded
+func toolFunction(name, arguments string) ToolFunction {
+	args, err := parseArguments(arguments)
+	if err != nil {
+		return ToolFunction{Name: name, Arguments: map[string]any{}, ArgumentsError: err.Error()}
+	}
+	return ToolFunction{Name: name, Arguments: args}
+}
+
+// parseArguments decodes the JSON arguments of a tool call
+// The error quotes the arguments, so the model can see what it got wrong
+func parseArguments(s string) (map[string]any, error) {
+	args := map[string]any{}
+	if strings.TrimSpace(s) == "" {
+		return args, nil
+	}
+	if err := json.Unmarshal([]byte(s), &args); err != nil {
+		if len(s) > maxQuotedArguments {
+			s = s[:maxQuotedArguments] + "..."
+		}
+		return nil, fmt.Errorf("arguments are not a valid JSON object (%v): %s", err, s)
+	}
+	return args, nil
+}
@@ -0,0 +1,160 @@
+package llm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Options are generation options sent with each chat request
+// Unset fields fall back to the server's defaults
+type Options struct {
+	Temperature *float64 `yaml:"temperature" json:"temperature,omitempty"`
+	// NumCtx is the context window size in tokens
+	NumCtx *int     `yaml:"num_ctx" json:"num_ctx,omitempty"`
+	Seed   *int     `yaml:"seed" json:"seed,omitempty"`
+	TopP   *float64 `yaml:"top_p" json:"top_p,omitempty"`
+	Stop   []string `yaml:"stop" json:"stop,omitempty"`
+	// KeepAlive is how long Ollama keeps the model loaded after a request, e.g. "10m" or "-1"
+	// It is sent next to the options rather than inside them
+	KeepAlive string `yaml:"keep_alive" json:"-"`
+}
+
+// OptionNames lists the option names accepted by Set
+var OptionNames = []string{"temperature", "num_ctx", "seed", "top_p", "stop", "keep_alive"}
+
+// Merge returns o with the fields set in override replaced
+func (o Options) Merge(override Options) Options {
+	if override.Temperature != nil {
+		o.Temperature = override.Temperature
+	}
+	if override.NumCtx != nil {
+		o.NumCtx = override.NumCtx
+	}
+	if override.Seed != nil {
+		o.Seed = override.Seed
+	}
+	if override.TopP != nil {
+		o.TopP = override.TopP
+	}
+	if override.Stop != nil {
+		o.Stop = override.Stop
+	}
+	if override.KeepAlive != "" {
+		o.KeepAlive = override.KeepAlive
+	}
+	return o
+}
+
+// IsZero reports whether no option is set
+func (o Options) IsZero() bool {
+	return o.Temperature == nil && o.NumCtx == nil && o.Seed == nil &&
+		o.TopP == nil && o.Stop == nil && o.KeepAlive == ""
+}
+
+// Set parses value and sets the named option
+// The value "default" unsets the option
+func (o *Options) Set(name, value string) error {
+	value = strings.TrimSpace(value)
+	reset := value == "default"
+
+	switch name {
+	case "temperature":
+		if reset {
+			o.Temperature = nil
+			return nil
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f < 0 {
+			return fmt.Errorf("temperature must be a non-negative number")
+		}
+		o.Temperature = &f
+	case "num_ctx":
+		if reset {
+			o.NumCtx = nil
+			return nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("num_ctx must be a positive integer")
+		}
+		o.NumCtx = &n
+	case "seed":
+		if reset {
+			o.Seed = nil
+			return nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("seed must be an integer")
+		}
+		o.Seed = &n
+	case "top_p":
+		if reset {
+			o.TopP = nil
+			return nil
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f < 0 || f > 1 {
+			return fmt.Errorf("top_p must be a number between 0 and 1")
+		}
+		o.TopP = &f
+	case "stop":
+		if reset {
+			o.Stop = nil
+			return nil
+		}
+		if value == "" {
+			return fmt.Errorf("stop must not be empty")
+		}
+		o.Stop = []string{value}
+	case "keep_alive":
+		if reset {
+			o.KeepAlive = ""
+			return nil
+		}
+		if value == "" {
+			return fmt.Errorf("keep_alive must not be empty")
+		}
+		o.KeepAlive = value
+	default:
+		return fmt.Errorf("unknown option '%s' (available: %s)", name, strings.Join(OptionNames, ", "))
+	}
+	return nil
+}
+
+// String formats the options that are set, e.g. "temperature=0.2 num_ctx=8192"
+func (o Options) String() string {
+	var parts []string
+	if o.Temperature != nil {
+		parts = append(parts, fmt.Sprintf("temperature=%g", *o.Temperature))
+	}
+	if o.NumCtx != nil {
+		parts = append(parts, fmt.Sprintf("num_ctx=%d", *o.NumCtx))
+	}
+	if o.Seed != nil {
+		parts = append(parts, fmt.Sprintf("seed=%d", *o.Seed))
+	}
+	if o.TopP != nil {
+		parts = append(parts, fmt.Sprintf("top_p=%g", *o.TopP))
+	}
+	if o.Stop != nil {
+		parts = append(parts, fmt.Sprintf("stop=%q", o.Stop))
+	}
+	if o.KeepAlive != "" {
+		parts = append(parts, fmt.Sprintf("keep_alive=%s", o.KeepAlive))
+	}
+	return strings.Join(parts, " ")
+}
+
+// keepAliveValue returns KeepAlive in the form Ollama expects
+// Plain numbers are seconds and must be sent as JSON numbers, durations like "10m" as strings
+func (o Options) keepAliveValue() any {
+	if o.KeepAlive == "" {
+		return nil
+	}
+	if n, err := strconv.ParseFloat(o.KeepAlive, 64); err == nil {
+		return n
+	}
+	return o.KeepAlive
+}
@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Provider names accepted in the config
+const (
+	ProviderOllama = "ollama"
+	ProviderOpenAI = "openai"
+)
+
+// Provider speaks the chat protocol of a model server
+type Provider interface {
+	// Name returns the provider name, e.g. "ollama"
+	Name() string
+
+	// BaseURL returns the URL of the server
+	BaseURL() string
+
+	// Chat sends a chat request and waits for the complete response
+	Chat(ctx context.Context, req ChatRequest) (*Message, Usage, error)
+
+	// ChatStream sends a chat request and calls callback for each chunk received
+	// If the stream is interrupted, the message received so far is returned along with the error
+	ChatStream(ctx context.Context, req ChatRequest, callback StreamCallback) (*Message, Usage, error)
+
+	// ListModels returns the names of the models available on the server
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// newHTTPClient returns the HTTP client used for chat requests
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout: 5 * time.Minute,
+	}
+}
+
+// doRequest sends a request that is aborted when ctx is cancelled
+// A nil body sends a GET request, otherwise the body is POSTed as JSON
+func doRequest(ctx context.Context, httpClient *http.Client, url string, body []byte, header http.Header) (*http.Response, error) {
+	method := http.MethodGet
+	var reader io.Reader
+	if body != nil {
+		method = http.MethodPost
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return httpClient.Do(req)
+}
+
+// statusError builds an error for an unexpected HTTP status
+// The start of the response body is included since servers usually explain the problem there
+func statusError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	msg := strings.TrimSpace(string(data))
+	if msg == "" {
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+	return fmt.Errorf("unexpected status: %d: %s", resp.StatusCode, msg)
+}
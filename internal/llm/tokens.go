@@ -0,0 +1,33 @@
+package llm
+
+import "encoding/json"
+
+// Rough number of characters per token for typical code and English text
+const charsPerToken = 4
+
+// Fixed per-message overhead for role markers and template tokens
+const messageOverheadTokens = 4
+
+// EstimateTokens estimates the number of tokens in a piece of text
+func EstimateTokens(text string) int {
+	return (len(text) + charsPerToken - 1) / charsPerToken
+}
+
+// EstimateMessageTokens estimates the number of tokens a message takes in the prompt
+func EstimateMessageTokens(m Message) int {
+	tokens := messageOverheadTokens + EstimateTokens(m.Content)
+	for _, tc := range m.ToolCalls {
+		args, _ := json.Marshal(tc.Function.Arguments)
+		tokens += EstimateTokens(tc.Function.Name) + EstimateTokens(string(args))
+	}
+	return tokens
+}
+
+// EstimateMessagesTokens estimates the number of tokens in a list of messages
+func EstimateMessagesTokens(messages []Message) int {
+	total := 0
+	for _, m := range messages {
+		total += EstimateMessageTokens(m)
+	}
+	return total
+}
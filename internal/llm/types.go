@@ -8,19 +8,27 @@ const (
 )
 
 type Message struct {
-	Role       string     `json:"role"`
-	Content    string     `json:"content"`
-	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
-	ToolCallID string     `json:"tool_call_id,omitempty"`
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID and ToolName identify the call a tool result answers
+	// ToolName is what Ollama uses for pairing, OpenAI-compatible servers use the ID
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	ToolName   string `json:"tool_name,omitempty"`
 }
 
 type ToolCall struct {
+	// ID is set by backends that identify tool calls, the agent generates one otherwise
+	ID       string       `json:"id,omitempty"`
 	Function ToolFunction `json:"function"`
 }
 
 type ToolFunction struct {
 	Name      string         `json:"name"`
 	Arguments map[string]any `json:"arguments"`
+	// ArgumentsError is set when the arguments the model sent could not be decoded,
+	// Arguments is empty then
+	ArgumentsError string `json:"-"`
 }
 
 type Tool struct {
@@ -43,17 +51,49 @@ type Parameters struct {
 type Property struct {
 	Type        string `json:"type"`
 	Description string `json:"description"`
+	// Enum lists the values a string property may have
+	Enum []string `json:"enum,omitempty"`
+	// Default is the value used when the argument is left out
+	Default any `json:"default,omitempty"`
+	// Minimum and Maximum bound a number or integer property
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+	// Items describes the elements of an array property
+	Items *Property `json:"items,omitempty"`
+	// Properties and Required describe an object property
+	Properties map[string]Property `json:"properties,omitempty"`
+	Required   []string            `json:"required,omitempty"`
+}
+
+// Bound returns a pointer to v for the Minimum and Maximum of a Property
+func Bound(v float64) *float64 {
+	return &v
 }
 
 type ChatRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-	Tools    []Tool    `json:"tools,omitempty"`
-	Stream   bool      `json:"stream"`
+	Model     string    `json:"model"`
+	Messages  []Message `json:"messages"`
+	Tools     []Tool    `json:"tools,omitempty"`
+	Stream    bool      `json:"stream"`
+	Options   *Options  `json:"options,omitempty"`
+	KeepAlive any       `json:"keep_alive,omitempty"`
 }
 
 type ChatResponse struct {
-	Model   string  `json:"model"`
-	Message Message `json:"message"`
-	Done    bool    `json:"done"`
+	Model           string  `json:"model"`
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	PromptEvalCount int     `json:"prompt_eval_count,omitempty"`
+	EvalCount       int     `json:"eval_count,omitempty"`
+}
+
+// Usage holds the token counts reported for a chat request
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Total returns the number of tokens in the prompt and the completion
+func (u Usage) Total() int {
+	return u.PromptTokens + u.CompletionTokens
 }
@@ -0,0 +1,318 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DanielNikkari/maahinen/internal/tools"
+)
+
+// protocolVersion is the MCP version requested in the handshake
+const protocolVersion = "2025-06-18"
+
+// supportedVersions are the protocol versions a server may answer with
+var supportedVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// Lines of server stderr kept for error messages
+const stderrLines = 20
+
+// How long a server gets to exit after its stdin is closed
+const closeTimeout = 2 * time.Second
+
+// JSON-RPC error code for methods the client doesn't implement
+const codeMethodNotFound = -32601
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// outgoing is a request or notification sent to the server
+type outgoing struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      *int64 `json:"id,omitempty"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// reply answers a request the server sent
+type reply struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// incoming is any message read from the server
+type incoming struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// client speaks JSON-RPC to a server process over its stdin and stdout,
+// one message per line
+type client struct {
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+	stdin  io.WriteCloser
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan incoming
+	stderr  []string
+	err     error // why the server exited
+
+	done chan struct{} // closed when the server exits
+}
+
+// startClient starts the server process
+func startClient(cfg ServerConfig, dir string) (*client, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, cfg.Command, cfg.Args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	for key, value := range cfg.Env {
+		cmd.Env = append(cmd.Env, key+"="+os.ExpandEnv(value))
+	}
+	tools.SetProcessGroup(cmd)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	c := &client{
+		cmd:     cmd,
+		cancel:  cancel,
+		stdin:   stdin,
+		pending: make(map[int64]chan incoming),
+		done:    make(chan struct{}),
+	}
+	stderrDone := make(chan struct{})
+	go func() {
+		c.readStderr(stderr)
+		close(stderrDone)
+	}()
+	go func() {
+		c.readLoop(stdout)
+		<-stderrDone
+		err := c.exitError(cmd.Wait())
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		close(c.done)
+	}()
+	return c, nil
+}
+
+// call sends a request and decodes the result into out
+// If ctx is cancelled first the server is told to stop working on the request
+func (c *client) call(ctx context.Context, method string, params, out any) error {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	ch := make(chan incoming, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.send(outgoing{JSONRPC: "2.0", ID: &id, Method: method, Params: params}); err != nil {
+		return err
+	}
+
+	select {
+	case msg := <-ch:
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if out == nil {
+			return nil
+		}
+		if err := json.Unmarshal(msg.Result, out); err != nil {
+			return fmt.Errorf("invalid %s result: %w", method, err)
+		}
+		return nil
+	case <-c.done:
+		return c.Err()
+	case <-ctx.Done():
+		_ = c.notify("notifications/cancelled", map[string]any{
+			"requestId": id,
+			"reason":    ctx.Err().Error(),
+		})
+		return ctx.Err()
+	}
+}
+
+// notify sends a notification, which gets no response
+func (c *client) notify(method string, params any) error {
+	return c.send(outgoing{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (c *client) send(msg any) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := c.stdin.Write(append(data, '\n')); err != nil {
+		select {
+		case <-c.done:
+			return c.Err()
+		default:
+		}
+		return fmt.Errorf("failed to write to server: %w", err)
+	}
+	return nil
+}
+
+// readLoop dispatches messages from the server until it closes stdout
+func (c *client) readLoop(r io.Reader) {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			c.handle(line)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *client) handle(line []byte) {
+	var msg incoming
+	if err := json.Unmarshal(line, &msg); err != nil {
+		// Servers sometimes log to stdout, keep it with stderr
+		c.addStderr(strings.TrimSpace(string(line)))
+		return
+	}
+
+	if msg.Method != "" {
+		if len(msg.ID) > 0 {
+			c.answer(msg)
+		}
+		// Notifications such as progress and log messages are ignored
+		return
+	}
+
+	var id int64
+	if err := json.Unmarshal(msg.ID, &id); err != nil {
+		return
+	}
+	c.mu.Lock()
+	ch, ok := c.pending[id]
+	c.mu.Unlock()
+	if ok {
+		ch <- msg
+	}
+}
+
+// answer responds to requests from the server
+// No client capabilities are declared, so only ping has to be supported
+func (c *client) answer(msg incoming) {
+	r := reply{JSONRPC: "2.0", ID: msg.ID}
+	if msg.Method == "ping" {
+		r.Result = struct{}{}
+	} else {
+		r.Error = &rpcError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+	_ = c.send(r)
+}
+
+func (c *client) readStderr(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			c.addStderr(line)
+		}
+	}
+}
+
+func (c *client) addStderr(line string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stderr = append(c.stderr, line)
+	if len(c.stderr) > stderrLines {
+		c.stderr = c.stderr[len(c.stderr)-stderrLines:]
+	}
+}
+
+// exitError describes why the server exited, with the last lines it printed
+func (c *client) exitError(err error) error {
+	msg := "server exited"
+	if err != nil {
+		msg += ": " + err.Error()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.stderr) > 0 {
+		msg += "\n" + strings.Join(c.stderr, "\n")
+	}
+	return errors.New(msg)
+}
+
+// Err returns why the server exited, or nil if it is running
+func (c *client) Err() error {
+	select {
+	case <-c.done:
+	default:
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close asks the server to exit by closing its stdin and kills it if it doesn't
+func (c *client) Close() {
+	c.writeMu.Lock()
+	c.stdin.Close()
+	c.writeMu.Unlock()
+
+	select {
+	case <-c.done:
+	case <-time.After(closeTimeout):
+		c.cancel()
+		<-c.done
+	}
+	c.cancel()
+}
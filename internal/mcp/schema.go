@@ -0,0 +1,138 @@
+package mcp
+
+import (
+	"encoding/json"
+
+	"github.com/DanielNikkari/maahinen/internal/llm"
+)
+
+// schema is the subset of JSON Schema tool definitions are converted from
+type schema struct {
+	Type        any                `json:"type"`
+	Description string             `json:"description"`
+	Enum        []any              `json:"enum"`
+	Default     any                `json:"default"`
+	Minimum     *float64           `json:"minimum"`
+	Maximum     *float64           `json:"maximum"`
+	Items       *schema            `json:"items"`
+	Properties  map[string]*schema `json:"properties"`
+	Required    []string           `json:"required"`
+	AnyOf       []*schema          `json:"anyOf"`
+	OneOf       []*schema          `json:"oneOf"`
+}
+
+// parameters converts a tool's input schema to the parameters sent to the model
+func parameters(raw json.RawMessage) (llm.Parameters, error) {
+	params := llm.Parameters{Type: "object", Properties: map[string]llm.Property{}}
+	if len(raw) == 0 {
+		return params, nil
+	}
+	var s schema
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return params, err
+	}
+	for name, p := range s.Properties {
+		if p != nil {
+			params.Properties[name] = property(p)
+		}
+	}
+	params.Required = s.Required
+	return params, nil
+}
+
+// property converts a schema to a property
+// Argument validation treats properties without a type as accepting anything, so unions
+// of different types are left untyped rather than rejecting some of their values
+func property(s *schema) llm.Property {
+	p := llm.Property{
+		Type:        schemaType(s),
+		Description: s.Description,
+		Default:     s.Default,
+		Minimum:     s.Minimum,
+		Maximum:     s.Maximum,
+		Required:    s.Required,
+	}
+
+	// A union with null is how optional arguments are often written
+	if p.Type == "" {
+		if only := nonNull(append(s.AnyOf, s.OneOf...)); only != nil {
+			inner := property(only)
+			if p.Description == "" {
+				p.Description = inner.Description
+			}
+			inner.Description = p.Description
+			return inner
+		}
+	}
+
+	if p.Type == "string" {
+		for _, v := range s.Enum {
+			if str, ok := v.(string); ok {
+				p.Enum = append(p.Enum, str)
+			}
+		}
+		if len(p.Enum) != len(s.Enum) {
+			p.Enum = nil
+		}
+	}
+	if s.Items != nil {
+		items := property(s.Items)
+		p.Items = &items
+	}
+	if len(s.Properties) > 0 {
+		p.Properties = make(map[string]llm.Property, len(s.Properties))
+		for name, prop := range s.Properties {
+			if prop != nil {
+				p.Properties[name] = property(prop)
+			}
+		}
+	}
+	return p
+}
+
+// schemaType returns the type of a schema, inferring it when it isn't given
+func schemaType(s *schema) string {
+	switch t := s.Type.(type) {
+	case string:
+		return t
+	case []any:
+		// ["string", "null"] and the like
+		var types []string
+		for _, v := range t {
+			if str, ok := v.(string); ok && str != "null" {
+				types = append(types, str)
+			}
+		}
+		if len(types) == 1 {
+			return types[0]
+		}
+		return ""
+	}
+
+	switch {
+	case len(s.Properties) > 0:
+		return "object"
+	case s.Items != nil:
+		return "array"
+	case len(s.Enum) > 0:
+		if _, ok := s.Enum[0].(string); ok {
+			return "string"
+		}
+	}
+	return ""
+}
+
+// nonNull returns the only option of a union that isn't null, if there is one
+func nonNull(options []*schema) *schema {
+	var found *schema
+	for _, o := range options {
+		if o == nil || schemaType(o) == "null" {
+			continue
+		}
+		if found != nil {
+			return nil
+		}
+		found = o
+	}
+	return found
+}
@@ -0,0 +1,312 @@
+// Package mcp connects to Model Context Protocol servers and offers their tools to the agent
+// Servers are started as child processes and spoken to over stdio
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DanielNikkari/maahinen/internal/tools"
+)
+
+// ServerConfig describes how to start an MCP server
+type ServerConfig struct {
+	// Command and Args start the server, which must speak MCP over its stdin and stdout
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+	// Env sets extra environment variables, $VAR and ${VAR} in values are expanded
+	Env map[string]string `yaml:"env"`
+	// Disabled keeps the server from being started
+	Disabled bool `yaml:"disabled"`
+	// TrustReadOnly lets tools the server marks read-only run concurrently with other
+	// read-only calls. Off by default, as the server's own word is all it is based on
+	TrustReadOnly bool `yaml:"trust_read_only"`
+}
+
+// How long a server gets to start and list its tools
+const startTimeout = 30 * time.Second
+
+// Sent to servers in the handshake
+const (
+	clientName    = "maahinen"
+	clientVersion = "dev"
+)
+
+// Server states
+const (
+	StateConnected = "connected"
+	StateFailed    = "failed"
+	StateExited    = "exited"
+	StateDisabled  = "disabled"
+)
+
+// ServerStatus describes a configured server for display
+type ServerStatus struct {
+	Name    string
+	Command string
+	State   string
+	// Server is the name and version the server reported
+	Server string
+	// Tools are the names the server's tools are registered under
+	Tools []string
+	Error string
+}
+
+// Server is a configured MCP server
+type Server struct {
+	name string
+	cfg  ServerConfig
+
+	mu     sync.Mutex
+	client *client
+	info   string
+	tools  []*Tool
+	err    error // why connecting failed
+}
+
+// connect starts the server, performs the handshake and lists its tools
+func (s *Server) connect(ctx context.Context, dir string) error {
+	c, err := startClient(s.cfg, dir)
+	if err != nil {
+		return err
+	}
+
+	var init struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		Capabilities    struct {
+			Tools *struct{} `json:"tools"`
+		} `json:"capabilities"`
+		ServerInfo struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"serverInfo"`
+	}
+	err = c.call(ctx, "initialize", map[string]any{
+		"protocolVersion": protocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": clientName, "version": clientVersion},
+	}, &init)
+	if err != nil {
+		c.Close()
+		return fmt.Errorf("initialize failed: %w", err)
+	}
+	if !slices.Contains(supportedVersions, init.ProtocolVersion) {
+		c.Close()
+		return fmt.Errorf("unsupported protocol version '%s'", init.ProtocolVersion)
+	}
+	if err := c.notify("notifications/initialized", nil); err != nil {
+		c.Close()
+		return err
+	}
+
+	var list []*Tool
+	if init.Capabilities.Tools != nil {
+		list, err = s.listTools(ctx, c)
+		if err != nil {
+			c.Close()
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.client = c
+	s.tools = list
+	s.info = strings.TrimSpace(init.ServerInfo.Name + " " + init.ServerInfo.Version)
+	return nil
+}
+
+// listTools fetches every page of the server's tools
+func (s *Server) listTools(ctx context.Context, c *client) ([]*Tool, error) {
+	var list []*Tool
+	cursor := ""
+	for {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var page struct {
+			Tools      []toolInfo `json:"tools"`
+			NextCursor string     `json:"nextCursor"`
+		}
+		if err := c.call(ctx, "tools/list", params, &page); err != nil {
+			return nil, fmt.Errorf("tools/list failed: %w", err)
+		}
+		for _, info := range page.Tools {
+			t, err := newTool(s, info)
+			if err != nil {
+				return nil, err
+			}
+			// Names differing only in characters tool names can't hold end up the same
+			for _, other := range list {
+				if other.name == t.name {
+					return nil, fmt.Errorf("tools '%s' and '%s' would both be named '%s'", other.remote, t.remote, t.name)
+				}
+			}
+			list = append(list, t)
+		}
+		if page.NextCursor == "" || page.NextCursor == cursor {
+			return list, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// callTool runs a tool on the server
+func (s *Server) callTool(ctx context.Context, name string, args map[string]any) (*callResult, error) {
+	s.mu.Lock()
+	c := s.client
+	s.mu.Unlock()
+	if c == nil {
+		return nil, fmt.Errorf("MCP server '%s' is not connected", s.name)
+	}
+	if err := c.Err(); err != nil {
+		return nil, fmt.Errorf("MCP server '%s' is not running: %w", s.name, err)
+	}
+
+	var result callResult
+	err := c.call(ctx, "tools/call", map[string]any{"name": name, "arguments": args}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *Server) status() ServerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := ServerStatus{
+		Name:    s.name,
+		Command: strings.Join(append([]string{s.cfg.Command}, s.cfg.Args...), " "),
+		Server:  s.info,
+	}
+	for _, t := range s.tools {
+		st.Tools = append(st.Tools, t.name)
+	}
+	switch {
+	case s.cfg.Disabled:
+		st.State = StateDisabled
+	case s.err != nil:
+		st.State = StateFailed
+		st.Error = s.err.Error()
+	case s.client == nil:
+		st.State = StateFailed
+	case s.client.Err() != nil:
+		st.State = StateExited
+		st.Error = s.client.Err().Error()
+	default:
+		st.State = StateConnected
+	}
+	return st
+}
+
+func (s *Server) close() {
+	s.mu.Lock()
+	c := s.client
+	s.mu.Unlock()
+	if c != nil {
+		c.Close()
+	}
+}
+
+// Manager starts the configured MCP servers and stops them on Close
+type Manager struct {
+	workDir string
+	servers []*Server
+}
+
+// NewManager creates a manager for the servers, keyed by name
+func NewManager(servers map[string]ServerConfig) *Manager {
+	m := &Manager{}
+	for name, cfg := range servers {
+		m.servers = append(m.servers, &Server{name: name, cfg: cfg})
+	}
+	sort.Slice(m.servers, func(i, j int) bool {
+		return m.servers[i].name < m.servers[j].name
+	})
+	return m
+}
+
+// SetWorkDir sets the directory servers are started in
+func (m *Manager) SetWorkDir(dir string) {
+	m.workDir = dir
+}
+
+// Start connects to all enabled servers at once
+// A server that fails to start doesn't stop the others, its error is shown in its status
+func (m *Manager) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, s := range m.servers {
+		if s.cfg.Disabled {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, startTimeout)
+			defer cancel()
+			if err := s.connect(ctx, m.workDir); err != nil {
+				s.mu.Lock()
+				s.err = err
+				s.mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Tools can be called by their own name when only one server has a tool by that name
+	count := map[string]int{}
+	for _, s := range m.servers {
+		for _, t := range s.tools {
+			count[t.remote]++
+		}
+	}
+	for _, s := range m.servers {
+		for _, t := range s.tools {
+			if count[t.remote] == 1 && t.remote != t.name {
+				t.alias = t.remote
+			}
+		}
+	}
+}
+
+// Tools returns the tools of the connected servers
+func (m *Manager) Tools() []tools.Tool {
+	var list []tools.Tool
+	for _, s := range m.servers {
+		s.mu.Lock()
+		for _, t := range s.tools {
+			list = append(list, t)
+		}
+		s.mu.Unlock()
+	}
+	return list
+}
+
+// Status returns the status of every configured server
+func (m *Manager) Status() []ServerStatus {
+	statuses := make([]ServerStatus, len(m.servers))
+	for i, s := range m.servers {
+		statuses[i] = s.status()
+	}
+	return statuses
+}
+
+// Close stops all servers
+func (m *Manager) Close() {
+	var wg sync.WaitGroup
+	for _, s := range m.servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.close()
+		}()
+	}
+	wg.Wait()
+}
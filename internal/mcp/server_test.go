@@ -0,0 +1,237 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubEnv makes the test binary run as a stub MCP server, its value picks the behaviour
+const stubEnv = "MAAHINEN_MCP_STUB"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(stubEnv); mode != "" {
+		runStubServer(mode)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runStubServer serves two pages of tools over stdio:
+// echo returns its arguments, fail returns an error result and exit stops the server
+func runStubServer(mode string) {
+	out := json.NewEncoder(os.Stdout)
+	send := func(id any, result any) {
+		_ = out.Encode(map[string]any{"jsonrpc": "2.0", "id": id, "result": result})
+	}
+
+	// Servers may log to stdout before the handshake
+	fmt.Println("stub server starting")
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var msg struct {
+			ID     any            `json:"id"`
+			Method string         `json:"method"`
+			Params map[string]any `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+
+		switch msg.Method {
+		case "initialize":
+			version := msg.Params["protocolVersion"]
+			if mode == "badversion" {
+				version = "1999-01-01"
+			}
+			send(msg.ID, map[string]any{
+				"protocolVersion": version,
+				"capabilities":    map[string]any{"tools": map[string]any{}},
+				"serverInfo":      map[string]any{"name": "stub", "version": "1.0"},
+			})
+
+		case "tools/list":
+			if msg.Params["cursor"] == "page2" {
+				send(msg.ID, map[string]any{"tools": []any{
+					map[string]any{"name": "fail", "inputSchema": map[string]any{"type": "object"}},
+					map[string]any{"name": "exit", "inputSchema": map[string]any{"type": "object"}},
+				}})
+				continue
+			}
+			send(msg.ID, map[string]any{
+				"tools": []any{map[string]any{
+					"name":        "echo",
+					"description": "Echo the text",
+					"inputSchema": map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"text":  map[string]any{"type": "string"},
+							"times": map[string]any{"type": []any{"integer", "null"}, "minimum": 1},
+						},
+						"required": []any{"text"},
+					},
+					"annotations": map[string]any{"readOnlyHint": true},
+				}},
+				"nextCursor": "page2",
+			})
+
+		case "tools/call":
+			args, _ := json.Marshal(msg.Params["arguments"])
+			switch msg.Params["name"] {
+			case "echo":
+				send(msg.ID, map[string]any{"content": []any{
+					map[string]any{"type": "text", "text": "echo " + string(args)},
+				}})
+			case "fail":
+				send(msg.ID, map[string]any{
+					"content": []any{map[string]any{"type": "text", "text": "something broke"}},
+					"isError": true,
+				})
+			case "exit":
+				fmt.Fprintln(os.Stderr, "stub server crashing")
+				os.Exit(3)
+			}
+		}
+	}
+}
+
+func startStub(t *testing.T, servers map[string]string) *Manager {
+	t.Helper()
+	configs := map[string]ServerConfig{}
+	for name, mode := range servers {
+		configs[name] = ServerConfig{
+			Command: os.Args[0],
+			Env:     map[string]string{stubEnv: mode},
+		}
+	}
+	m := NewManager(configs)
+	m.SetWorkDir(t.TempDir())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	m.Start(ctx)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func getTool(t *testing.T, m *Manager, name string) *Tool {
+	t.Helper()
+	for _, tool := range m.Tools() {
+		if tool.Name() == name {
+			return tool.(*Tool)
+		}
+	}
+	t.Fatalf("tool %s not found", name)
+	return nil
+}
+
+func TestHandshake(t *testing.T) {
+	m := startStub(t, map[string]string{"stub": "ok"})
+
+	st := m.Status()[0]
+	if st.State != StateConnected {
+		t.Fatalf("state %s, want %s: %s", st.State, StateConnected, st.Error)
+	}
+	if st.Server != "stub 1.0" {
+		t.Errorf("server %q, want %q", st.Server, "stub 1.0")
+	}
+	// The tools of both pages are listed
+	want := []string{"stub__echo", "stub__fail", "stub__exit"}
+	if !reflect.DeepEqual(st.Tools, want) {
+		t.Errorf("tools %v, want %v", st.Tools, want)
+	}
+
+	echo := getTool(t, m, "stub__echo")
+	if got := echo.Aliases(); !reflect.DeepEqual(got, []string{"echo"}) {
+		t.Errorf("aliases %v, want [echo]", got)
+	}
+	params := echo.Definition().Function.Parameters
+	if !reflect.DeepEqual(params.Required, []string{"text"}) {
+		t.Errorf("required %v, want [text]", params.Required)
+	}
+	if times := params.Properties["times"]; times.Type != "integer" || times.Minimum == nil || *times.Minimum != 1 {
+		t.Errorf("times property %+v, want an integer of at least 1", times)
+	}
+	if echo.ReadOnly() {
+		t.Error("read-only hint trusted without trust_read_only")
+	}
+}
+
+func TestCallTool(t *testing.T) {
+	m := startStub(t, map[string]string{"stub": "ok"})
+
+	result, err := getTool(t, m, "stub__echo").Execute(context.Background(), map[string]any{"text": "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success || result.Output != `echo {"text":"hi"}` {
+		t.Errorf("echo result %+v", result)
+	}
+
+	result, err = getTool(t, m, "stub__fail").Execute(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Success || result.Error != "something broke" {
+		t.Errorf("fail result %+v, want an error result", result)
+	}
+}
+
+func TestUnsupportedProtocolVersion(t *testing.T) {
+	m := startStub(t, map[string]string{"old": "badversion"})
+
+	st := m.Status()[0]
+	if st.State != StateFailed {
+		t.Fatalf("state %s, want %s", st.State, StateFailed)
+	}
+	if !strings.Contains(st.Error, "unsupported protocol version '1999-01-01'") {
+		t.Errorf("error %q", st.Error)
+	}
+	if len(m.Tools()) != 0 {
+		t.Errorf("got tools from a failed server")
+	}
+}
+
+func TestServerExitsMidSession(t *testing.T) {
+	m := startStub(t, map[string]string{"stub": "ok"})
+
+	result, err := getTool(t, m, "stub__exit").Execute(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Success || !strings.Contains(result.Error, "server exited") || !strings.Contains(result.Error, "stub server crashing") {
+		t.Errorf("exit result %+v, want the exit with the server's output", result)
+	}
+
+	st := m.Status()[0]
+	if st.State != StateExited {
+		t.Errorf("state %s, want %s", st.State, StateExited)
+	}
+
+	result, _ = getTool(t, m, "stub__echo").Execute(context.Background(), map[string]any{"text": "hi"})
+	if result.Success || !strings.Contains(result.Error, "is not running") {
+		t.Errorf("call after exit %+v, want a not running error", result)
+	}
+}
+
+func TestToolName(t *testing.T) {
+	if got := toolName("git hub", "get.issue"); got != "git_hub__get_issue" {
+		t.Errorf("toolName = %q", got)
+	}
+
+	long := strings.Repeat("x", 70)
+	a, b := toolName("srv", long+"_a"), toolName("srv", long+"_b")
+	if len(a) != maxToolNameLength || len(b) != maxToolNameLength {
+		t.Errorf("lengths %d and %d, want %d", len(a), len(b), maxToolNameLength)
+	}
+	if a == b {
+		t.Errorf("long names both map to %q", a)
+	}
+}
@@ -0,0 +1,161 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/DanielNikkari/maahinen/internal/llm"
+	"github.com/DanielNikkari/maahinen/internal/tools"
+)
+
+// toolInfo is a tool as listed by a server
+type toolInfo struct {
+	Name        string          `json:"name"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+	Annotations struct {
+		ReadOnlyHint bool `json:"readOnlyHint"`
+	} `json:"annotations"`
+}
+
+// content is an item in the result of a tool call
+type content struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	MimeType string `json:"mimeType"`
+	URI      string `json:"uri"`
+	Resource struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"resource"`
+}
+
+// callResult is the result of tools/call
+type callResult struct {
+	Content           []content       `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent"`
+	IsError           bool            `json:"isError"`
+}
+
+// Tool is a tool offered by an MCP server
+// It is registered as <server>__<tool> so tools of different servers can't clash
+type Tool struct {
+	server     *Server
+	name       string
+	remote     string
+	definition llm.Tool
+	readOnly   bool
+	// alias is the tool's own name, when no other server has a tool by that name
+	alias string
+}
+
+var invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// Longest tool name model APIs accept
+const maxToolNameLength = 64
+
+func newTool(s *Server, info toolInfo) (*Tool, error) {
+	params, err := parameters(info.InputSchema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid input schema for tool '%s': %w", info.Name, err)
+	}
+
+	name := toolName(s.name, info.Name)
+	description := info.Description
+	if description == "" {
+		description = info.Title
+	}
+
+	return &Tool{
+		server: s,
+		name:   name,
+		remote: info.Name,
+		definition: llm.Tool{
+			Type: "function",
+			Function: llm.ToolDefinition{
+				Name:        name,
+				Description: description,
+				Parameters:  params,
+			},
+		},
+		readOnly: s.cfg.TrustReadOnly && info.Annotations.ReadOnlyHint,
+	}, nil
+}
+
+// toolName returns the name a server's tool is registered under
+// Names too long for model APIs are cut short and end with a hash of the full name, so
+// tools with the same long prefix stay apart
+func toolName(server, tool string) string {
+	full := server + "__" + tool
+	name := invalidNameChars.ReplaceAllString(full, "_")
+	if len(name) <= maxToolNameLength {
+		return name
+	}
+	sum := sha256.Sum256([]byte(full))
+	suffix := "_" + hex.EncodeToString(sum[:4])
+	return name[:maxToolNameLength-len(suffix)] + suffix
+}
+
+func (t *Tool) Name() string         { return t.name }
+func (t *Tool) Description() string  { return t.definition.Function.Description }
+func (t *Tool) Definition() llm.Tool { return t.definition }
+
+// Aliases lets models call the tool without the server prefix
+func (t *Tool) Aliases() []string {
+	if t.alias == "" {
+		return nil
+	}
+	return []string{t.alias}
+}
+
+// ReadOnly reports whether the server marked the tool as free of side effects and the
+// config trusts the server to say so
+func (t *Tool) ReadOnly() bool { return t.readOnly }
+
+func (t *Tool) Execute(ctx context.Context, args map[string]any) (tools.Result, error) {
+	if args == nil {
+		args = map[string]any{}
+	}
+	result, err := t.server.callTool(ctx, t.remote, args)
+	if err != nil {
+		return tools.Result{Success: false, Error: err.Error()}, nil
+	}
+
+	output := resultText(result)
+	if result.IsError {
+		return tools.Result{Success: false, Error: output}, nil
+	}
+	return tools.Result{Success: true, Output: output}, nil
+}
+
+// resultText joins the content of a result into text for the model
+// Content the model can't read, like images, is described instead
+func resultText(r *callResult) string {
+	var parts []string
+	for _, c := range r.Content {
+		switch c.Type {
+		case "text":
+			parts = append(parts, c.Text)
+		case "resource":
+			if c.Resource.Text != "" {
+				parts = append(parts, c.Resource.Text)
+			} else {
+				parts = append(parts, fmt.Sprintf("[resource %s]", c.Resource.URI))
+			}
+		case "resource_link":
+			parts = append(parts, fmt.Sprintf("[resource %s]", c.URI))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content, %s]", c.Type, c.MimeType))
+		}
+	}
+	if len(parts) == 0 && len(r.StructuredContent) > 0 {
+		return string(r.StructuredContent)
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,546 @@
+// Package permission decides which tool calls may run without asking the user
+package permission
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Action is what happens to a tool call matched by a rule
+type Action string
+
+const (
+	Allow Action = "allow"
+	Ask   Action = "ask"
+	Deny  Action = "deny"
+)
+
+// Rule matches tool calls by tool name and argument pattern
+type Rule struct {
+	// Tool is the tool name, "*" matches every tool
+	Tool string `yaml:"tool"`
+	// Pattern is matched against the call's subject: the command for bash and the
+	// path for file tools. * matches any characters including / and spaces, ? matches
+	// one character. An empty pattern matches every call of the tool
+	Pattern string `yaml:"pattern,omitempty"`
+	Action  Action `yaml:"action"`
+}
+
+func (r Rule) String() string {
+	if r.Pattern == "" {
+		return fmt.Sprintf("%s %s", r.Action, r.Tool)
+	}
+	return fmt.Sprintf("%s %s %q", r.Action, r.Tool, r.Pattern)
+}
+
+// Validate checks that the rules are well formed
+func Validate(rules []Rule) error {
+	for i, r := range rules {
+		switch r.Action {
+		case Allow, Ask, Deny:
+		default:
+			return fmt.Errorf("permission rule %d: unknown action '%s' (expected allow, ask or deny)", i+1, r.Action)
+		}
+		if r.Tool == "" {
+			return fmt.Errorf("permission rule %d: missing tool", i+1)
+		}
+	}
+	return nil
+}
+
+// Policy evaluates tool calls against rules
+// Deny and ask rules from the config are checked first. Then rules added during the session
+// and rules saved with "always allow" are checked before the allow rules from the config
+type Policy struct {
+	mu        sync.Mutex
+	root      string
+	session   []Rule
+	persisted []Rule
+	config    []Rule
+	path      string // file "always allow" rules are saved to, empty to not save
+}
+
+// New creates a policy with the rules from the config
+// Paths in tool arguments are matched relative to root, or the current directory if root is empty
+func New(root string, rules []Rule) *Policy {
+	if root == "" {
+		root, _ = os.Getwd()
+	}
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	return &Policy{root: root, config: rules}
+}
+
+// DefaultPath returns the file "always allow" rules are saved to
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".maahinen", "permissions.yaml")
+	}
+	return filepath.Join(home, ".maahinen", "permissions.yaml")
+}
+
+// Load reads the saved rules from path and saves new ones there
+// A missing file is not an error
+func (p *Policy) Load(path string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.path = path
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read permissions: %w", err)
+	}
+
+	var file struct {
+		Rules []Rule `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := Validate(file.Rules); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	p.persisted = file.Rules
+	return nil
+}
+
+// Check decides what to do with a tool call
+// Deny rules always win, then ask rules in the config that no earlier config rule overrides.
+// Otherwise the first matching rule decides for each subject of the call, and the call is
+// allowed only if every subject is. Allow rules only match a bash command that redirects
+// to a file if they name the redirection. If no rule matches, ok is false and the caller
+// picks the default. The returned rule explains the decision
+func (p *Policy) Check(tool string, args map[string]any) (action Action, rule Rule, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rules := p.rules()
+	subjects, opaque := p.subjects(tool, args)
+	if len(subjects) == 0 {
+		// Only tool-wide rules apply to calls without a subject
+		subjects = []string{""}
+	}
+
+	for _, subject := range subjects {
+		for _, r := range rules {
+			if r.Action == Deny && r.matches(tool, subject) {
+				return Deny, r, true
+			}
+		}
+	}
+	// Saved allows answer the prompts of calls no config rule decides, so they don't
+	// override an ask rule from the config
+	for _, subject := range subjects {
+		if r, ok := decide(p.config, tool, subject); ok && r.Action == Ask {
+			return Ask, r, true
+		}
+	}
+	if opaque {
+		// Part of what runs can't be matched, so no allow rule can vouch for it
+		return "", Rule{}, false
+	}
+
+	var allowRule Rule
+	allowed := 0
+	for _, subject := range subjects {
+		r, ok := decide(rules, tool, subject)
+		if !ok {
+			continue
+		}
+		if r.Action == Ask {
+			return Ask, r, true
+		}
+		allowRule = r
+		allowed++
+	}
+	if allowed == len(subjects) {
+		return Allow, allowRule, true
+	}
+	return "", Rule{}, false
+}
+
+// decide returns the first allow or ask rule matching a subject of a call
+func decide(rules []Rule, tool, subject string) (Rule, bool) {
+	redirected := isBash(tool) && hasRedirect(subject)
+	for _, r := range rules {
+		if r.Action == Deny || !r.matches(tool, subject) {
+			continue
+		}
+		if r.Action == Allow && redirected && !r.namesRedirects(subject) {
+			// A wildcard would vouch for a file the command writes or reads
+			continue
+		}
+		return r, true
+	}
+	return Rule{}, false
+}
+
+// AllowRules returns the rules that allow exactly this call
+func (p *Policy) AllowRules(tool string, args map[string]any) []Rule {
+	subjects, opaque := p.subjects(tool, args)
+	if opaque {
+		return nil
+	}
+	if len(subjects) == 0 {
+		return []Rule{{Tool: tool, Action: Allow}}
+	}
+	rules := make([]Rule, len(subjects))
+	for i, s := range subjects {
+		rules[i] = Rule{Tool: tool, Pattern: escape(s), Action: Allow}
+	}
+	return rules
+}
+
+// AddSession adds rules that apply until the session ends
+func (p *Policy) AddSession(rules []Rule) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.session = append(p.session, rules...)
+}
+
+// ClearSession removes the rules added for the session
+func (p *Policy) ClearSession() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.session = nil
+}
+
+// Persist adds rules and saves them so they apply to future sessions as well
+func (p *Policy) Persist(rules []Rule) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.persisted = append(p.persisted, rules...)
+	if p.path == "" {
+		return nil
+	}
+
+	data, err := yaml.Marshal(struct {
+		Rules []Rule `yaml:"rules"`
+	}{p.persisted})
+	if err != nil {
+		return fmt.Errorf("failed to marshal permissions: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0755); err != nil {
+		return fmt.Errorf("failed to create permissions directory: %w", err)
+	}
+	if err := os.WriteFile(p.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write permissions: %w", err)
+	}
+	return nil
+}
+
+// Rules returns every rule, session and saved rules before the config's
+func (p *Policy) Rules() []Rule {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rules()
+}
+
+func (p *Policy) rules() []Rule {
+	rules := make([]Rule, 0, len(p.session)+len(p.persisted)+len(p.config))
+	rules = append(rules, p.session...)
+	rules = append(rules, p.persisted...)
+	return append(rules, p.config...)
+}
+
+func (r Rule) matches(tool, subject string) bool {
+	if r.Tool != "*" && r.Tool != tool {
+		return false
+	}
+	if r.Pattern == "" || r.Pattern == "*" {
+		return true
+	}
+	return subject != "" && globRegexp(r.Pattern, true).MatchString(subject)
+}
+
+// namesRedirects reports whether the rule's pattern matches a redirected command with
+// its wildcards kept clear of < and >, so the redirections are spelled out in the rule
+func (r Rule) namesRedirects(subject string) bool {
+	return r.Pattern != "" && globRegexp(r.Pattern, false).MatchString(subject)
+}
+
+func isBash(tool string) bool {
+	return tool == "bash" || tool == "bash_background"
+}
+
+// subjects returns what rule patterns are matched against for a call
+// A bash command is split into the commands chained with &&, ||, ;, |, & or newlines
+// so that allowing "go test *" doesn't allow "go test && rm -rf ~". opaque is true when
+// the command also runs commands allow rules can't see, see splitCommand
+func (p *Policy) subjects(tool string, args map[string]any) (subjects []string, opaque bool) {
+	switch {
+	case isBash(tool):
+		command, _ := args["command"].(string)
+		return splitCommand(command)
+	case tool == "apply_patch":
+		patch, _ := args["patch"].(string)
+		var paths []string
+		for _, path := range patchPaths(patch) {
+			paths = append(paths, p.relPath(path))
+		}
+		return paths, false
+	}
+
+	path, ok := args["path"].(string)
+	if !ok {
+		return nil, false
+	}
+	return []string{p.relPath(path)}, false
+}
+
+// relPath returns a path relative to the root, or absolute if it is outside the root
+func (p *Policy) relPath(path string) string {
+	if path == "" {
+		path = "."
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(p.root, path)
+	}
+	path = filepath.Clean(path)
+	if rel, err := filepath.Rel(p.root, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		path = rel
+	}
+	return filepath.ToSlash(path)
+}
+
+// splitCommand splits a shell command into the commands it chains with &&, ||, ;, |, &
+// or newlines, leaving quoted text alone. Command substitution ($(...) and backticks),
+// process substitution and subshells nest commands inside others. Their insides are
+// split out too so deny rules see them, and opaque is set so allow rules don't apply
+func splitCommand(command string) (parts []string, opaque bool) {
+	var current strings.Builder
+	flush := func() {
+		if part := strings.TrimSpace(current.String()); part != "" {
+			parts = append(parts, part)
+		}
+		current.Reset()
+	}
+
+	var quote byte
+	depth := 0 // open $( and ( that a ) closes, even inside double quotes
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		next := byte(0)
+		if i+1 < len(command) {
+			next = command[i+1]
+		}
+
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+			current.WriteByte(c)
+			continue
+		case c == '\\' && next != 0:
+			current.WriteByte(c)
+			current.WriteByte(next)
+			i++
+			continue
+		case quote == '"' && c == '"':
+			quote = 0
+			current.WriteByte(c)
+			continue
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote = c
+			current.WriteByte(c)
+			continue
+		}
+
+		// Substitutions also run inside double quotes
+		switch {
+		case c == '`', c == '$' && next == '(':
+			opaque = true
+			flush()
+			if c == '$' {
+				depth++
+				i++
+			}
+			continue
+		case c == ')' && depth > 0:
+			depth--
+			flush()
+			continue
+		case quote != 0:
+			current.WriteByte(c)
+			continue
+		case c == '(' || c == ')':
+			// Subshells and <(...) or >(...) process substitution
+			opaque = true
+			if c == '(' {
+				depth++
+			}
+			if s := current.String(); c == '(' && (strings.HasSuffix(s, "<") || strings.HasSuffix(s, ">")) {
+				current.Reset()
+				current.WriteString(s[:len(s)-1])
+			}
+			flush()
+			continue
+		case c == ';' || c == '\n':
+			flush()
+			continue
+		case c == '|':
+			// ||, | and |&
+			if next == '|' || next == '&' {
+				i++
+			}
+			flush()
+			continue
+		case c == '&':
+			// &> and >& (as in 2>&1) redirect output, they don't start a command
+			prev := byte(0)
+			if current.Len() > 0 {
+				prev = current.String()[current.Len()-1]
+			}
+			if next == '>' || prev == '>' || prev == '<' {
+				current.WriteByte(c)
+				continue
+			}
+			if next == '&' {
+				i++
+			}
+			flush()
+			continue
+		}
+		current.WriteByte(c)
+	}
+	flush()
+	return parts, opaque
+}
+
+// hasRedirect reports whether a command redirects input or output to a file
+// Duplicating descriptors, as in 2>&1, and redirecting to /dev/null are not counted
+func hasRedirect(command string) bool {
+	var quote byte
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+			continue
+		case c == '\\':
+			i++
+			continue
+		case c == '\'' || c == '"':
+			quote = c
+			continue
+		case c != '<' && c != '>':
+			continue
+		}
+
+		// Skip the rest of the operator: >>, >|, <<, <<<, <>, >& and <&
+		j := i + 1
+		for j < len(command) && strings.IndexByte("<>|&", command[j]) >= 0 {
+			j++
+		}
+		op := command[i:j]
+		target := strings.TrimLeft(command[j:], " \t")
+		if end := strings.IndexAny(target, " \t;&|<>"); end >= 0 {
+			target = target[:end]
+		}
+		i = j - 1
+
+		if strings.HasSuffix(op, "&") && target != "" && strings.Trim(target, "0123456789-") == "" {
+			continue
+		}
+		if target == "/dev/null" {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// patchPaths returns the files a unified diff touches
+func patchPaths(patch string) []string {
+	var paths []string
+	seen := map[string]bool{}
+	for _, line := range strings.Split(patch, "\n") {
+		if !strings.HasPrefix(line, "--- ") && !strings.HasPrefix(line, "+++ ") {
+			continue
+		}
+		path := strings.TrimSpace(strings.SplitN(line[4:], "\t", 2)[0])
+		if path == "/dev/null" {
+			continue
+		}
+		if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+			path = path[2:]
+		}
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+var (
+	globCache   = map[string]*regexp.Regexp{}
+	globCacheMu sync.Mutex
+)
+
+// globRegexp converts a rule pattern to an anchored regex
+// A backslash makes the next character literal. Without spanRedirects * and ? don't
+// match < or >
+func globRegexp(pattern string, spanRedirects bool) *regexp.Regexp {
+	key := pattern
+	wild := "."
+	if !spanRedirects {
+		key = "\x00" + pattern
+		wild = "[^<>]"
+	}
+
+	globCacheMu.Lock()
+	defer globCacheMu.Unlock()
+	if re, ok := globCache[key]; ok {
+		return re
+	}
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; c {
+		case '*':
+			sb.WriteString(wild + "*")
+		case '?':
+			sb.WriteString(wild)
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(runes[i])))
+			} else {
+				sb.WriteString(`\\`)
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+
+	re := regexp.MustCompile("(?s)" + sb.String())
+	globCache[key] = re
+	return re
+}
+
+// escape makes every character of s literal in a rule pattern
+func escape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`)
+	return r.Replace(s)
+}
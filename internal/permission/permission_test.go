@@ -0,0 +1,171 @@
+package permission
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+		opaque  bool
+	}{
+		{"go test ./...", []string{"go test ./..."}, false},
+		{"go build && rm -rf ~", []string{"go build", "rm -rf ~"}, false},
+		{"a || b; c | d |& e", []string{"a", "b", "c", "d", "e"}, false},
+		{"npm run dev & curl localhost", []string{"npm run dev", "curl localhost"}, false},
+		{"make\nmake install", []string{"make", "make install"}, false},
+		{"go test ./... 2>&1 | tee out.txt", []string{"go test ./... 2>&1", "tee out.txt"}, false},
+		{"go test &> out.txt", []string{"go test &> out.txt"}, false},
+		{`echo "a && b; c" 'd | e'`, []string{`echo "a && b; c" 'd | e'`}, false},
+		{`echo a\;b`, []string{`echo a\;b`}, false},
+		{"go test $(rm -rf ~)", []string{"go test", "rm -rf ~"}, true},
+		{`echo "$(whoami)"`, []string{`echo "`, "whoami", `"`}, true},
+		{"go test `rm -rf ~`", []string{"go test", "rm -rf ~"}, true},
+		{"diff <(ls a) <(ls b)", []string{"diff", "ls a", "ls b"}, true},
+		{"(cd sub && make)", []string{"cd sub", "make"}, true},
+	}
+	for _, tt := range tests {
+		parts, opaque := splitCommand(tt.command)
+		if !reflect.DeepEqual(parts, tt.want) || opaque != tt.opaque {
+			t.Errorf("splitCommand(%q) = %q, %v, want %q, %v", tt.command, parts, opaque, tt.want, tt.opaque)
+		}
+	}
+}
+
+func TestHasRedirect(t *testing.T) {
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{"go test ./...", false},
+		{"go test ./... > out.txt", true},
+		{"go test ./...>>out.txt", true},
+		{"go test &> out.txt", true},
+		{"sort < input.txt", true},
+		{"cat <<EOF", true},
+		{"go test ./... 2>&1", false},
+		{"echo hi >&2", false},
+		{"go test > /dev/null 2>&1", false},
+		{`grep "a > b" file`, false},
+		{`grep 'a<b' file`, false},
+		{`echo a\>b`, false},
+	}
+	for _, tt := range tests {
+		if got := hasRedirect(tt.command); got != tt.want {
+			t.Errorf("hasRedirect(%q) = %v, want %v", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	config := []Rule{
+		{Tool: "bash", Pattern: "rm -rf *", Action: Deny},
+		{Tool: "bash", Pattern: "go test *", Action: Allow},
+		{Tool: "bash", Pattern: "go test * > *.log", Action: Allow},
+		{Tool: "bash", Pattern: "git push*", Action: Ask},
+		{Tool: "write", Pattern: "src/*", Action: Allow},
+		{Tool: "write", Action: Ask},
+		{Tool: "read", Action: Allow},
+	}
+	root := t.TempDir()
+
+	tests := []struct {
+		name string
+		tool string
+		args map[string]any
+		want Action // empty when no rule decides
+	}{
+		{"allowed command", "bash", map[string]any{"command": "go test ./..."}, Allow},
+		{"chained command not allowed", "bash", map[string]any{"command": "go test ./... && make"}, ""},
+		{"denied command in a chain", "bash", map[string]any{"command": "go test ./... ; rm -rf ~"}, Deny},
+		{"denied command in a substitution", "bash", map[string]any{"command": "echo $(rm -rf ~)"}, Deny},
+		{"substitution not allowed", "bash", map[string]any{"command": "go test $(cat list)"}, ""},
+		{"redirection not allowed by a wildcard", "bash", map[string]any{"command": "go test ./... > ~/.bashrc"}, ""},
+		{"redirection named by the rule", "bash", map[string]any{"command": "go test ./... > test.log"}, Allow},
+		{"redirection wildcard can't span another", "bash", map[string]any{"command": "go test ./... > ~/.bashrc > x.log"}, ""},
+		{"descriptor duplication allowed", "bash", map[string]any{"command": "go test ./... 2>&1"}, Allow},
+		{"ask rule", "bash", map[string]any{"command": "git push origin main"}, Ask},
+		{"path allowed", "write", map[string]any{"path": "src/main.go"}, Allow},
+		{"absolute path inside the root", "write", map[string]any{"path": filepath.Join(root, "src", "a.go")}, Allow},
+		{"path escaping the pattern", "write", map[string]any{"path": "src/../main.go"}, Ask},
+		{"tool-wide rule", "read", map[string]any{"path": "/etc/passwd"}, Allow},
+		{"no rule", "edit", map[string]any{"path": "main.go"}, ""},
+		{"patch paths", "apply_patch", map[string]any{"patch": "--- a/src/a.go\n+++ b/src/a.go\n"}, ""},
+	}
+
+	p := New(root, config)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, rule, ok := p.Check(tt.tool, tt.args)
+			if tt.want == "" {
+				if ok {
+					t.Errorf("got %s by rule %s, want no decision", action, rule)
+				}
+				return
+			}
+			if !ok || action != tt.want {
+				t.Errorf("got %s (decided %v) by rule %s, want %s", action, ok, rule, tt.want)
+			}
+		})
+	}
+}
+
+func TestSavedRulesOrder(t *testing.T) {
+	p := New(t.TempDir(), []Rule{
+		{Tool: "write", Pattern: "secrets/*", Action: Ask},
+		{Tool: "bash", Pattern: "git *", Action: Allow},
+		{Tool: "bash", Pattern: "git push*", Action: Ask},
+	})
+	if err := p.Persist([]Rule{
+		{Tool: "write", Action: Allow},
+		{Tool: "bash", Pattern: "git push*", Action: Allow},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	p.AddSession([]Rule{{Tool: "bash", Pattern: "make", Action: Allow}})
+
+	tests := []struct {
+		tool string
+		args map[string]any
+		want Action
+	}{
+		// A saved allow doesn't override an ask rule from the config
+		{"write", map[string]any{"path": "secrets/key"}, Ask},
+		{"write", map[string]any{"path": "main.go"}, Allow},
+		// An earlier config allow still comes before a later config ask
+		{"bash", map[string]any{"command": "git push"}, Allow},
+		{"bash", map[string]any{"command": "make"}, Allow},
+	}
+	for _, tt := range tests {
+		if action, rule, _ := p.Check(tt.tool, tt.args); action != tt.want {
+			t.Errorf("Check(%s, %v) = %s by rule %s, want %s", tt.tool, tt.args, action, rule, tt.want)
+		}
+	}
+}
+
+func TestAllowRules(t *testing.T) {
+	p := New(t.TempDir(), nil)
+
+	rules := p.AllowRules("bash", map[string]any{"command": "ls *.go && go test ./... > out.txt"})
+	want := []Rule{
+		{Tool: "bash", Pattern: `ls \*.go`, Action: Allow},
+		{Tool: "bash", Pattern: "go test ./... > out.txt", Action: Allow},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Fatalf("AllowRules = %v, want %v", rules, want)
+	}
+	p.AddSession(rules)
+	if action, _, _ := p.Check("bash", map[string]any{"command": "ls *.go && go test ./... > out.txt"}); action != Allow {
+		t.Errorf("the saved rules don't allow the call they were made for")
+	}
+	if action, _, _ := p.Check("bash", map[string]any{"command": "ls main.go"}); action == Allow {
+		t.Errorf("an escaped * matched other text")
+	}
+
+	if rules := p.AllowRules("bash", map[string]any{"command": "echo $(date)"}); rules != nil {
+		t.Errorf("AllowRules for a substitution = %v, want none", rules)
+	}
+}
@@ -0,0 +1,203 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DanielNikkari/maahinen/internal/llm"
+)
+
+// ToolCall is a record of a tool call shown in the tool panel
+type ToolCall struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+	Status    string         `json:"status"` // "success", "error", "cancelled"
+	Output    string         `json:"output,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// Session is a persisted conversation
+type Session struct {
+	ID        string        `json:"id"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	Model     string        `json:"model"`
+	WorkDir   string        `json:"work_dir"`
+	Messages  []llm.Message `json:"messages"`
+	ToolCalls []ToolCall    `json:"tool_calls"`
+}
+
+// New creates a new empty session for the given model
+func New(model string) *Session {
+	now := time.Now()
+	workDir, _ := os.Getwd()
+
+	return &Session{
+		ID:        newID(now),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Model:     model,
+		WorkDir:   workDir,
+		Messages:  []llm.Message{},
+		ToolCalls: []ToolCall{},
+	}
+}
+
+// Title returns a short description of the session based on the first user message
+func (s *Session) Title() string {
+	for _, msg := range s.Messages {
+		if msg.Role != llm.RoleUser {
+			continue
+		}
+		title := strings.Join(strings.Fields(msg.Content), " ")
+		if len(title) > 50 {
+			title = title[:47] + "..."
+		}
+		return title
+	}
+	return "(empty)"
+}
+
+// HasHistory reports whether the session contains any user messages
+func (s *Session) HasHistory() bool {
+	for _, msg := range s.Messages {
+		if msg.Role == llm.RoleUser {
+			return true
+		}
+	}
+	return false
+}
+
+// newID generates a sortable, unique session ID
+func newID(t time.Time) string {
+	b := make([]byte, 2)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%s", t.Format("20060102-150405"), hex.EncodeToString(b))
+}
+
+// Store saves and loads sessions as JSON files in a directory
+type Store struct {
+	dir string
+}
+
+// NewStore creates a store in the given directory
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// DefaultDir returns the default session directory (~/.maahinen/sessions)
+func DefaultDir() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".maahinen", "sessions")
+	}
+	return filepath.Join(".maahinen", "sessions")
+}
+
+// Save writes the session to disk
+func (st *Store) Save(s *Session) error {
+	if err := os.MkdirAll(st.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	s.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated session
+	path := st.path(s.ID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+
+	return nil
+}
+
+// Load loads a session by ID or by a unique ID prefix
+func (st *Store) Load(id string) (*Session, error) {
+	if s, err := st.read(st.path(id)); err == nil {
+		return s, nil
+	}
+
+	sessions, err := st.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*Session
+	for _, s := range sessions {
+		if strings.HasPrefix(s.ID, id) {
+			matches = append(matches, s)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("session '%s' not found", id)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("session ID '%s' is ambiguous (%d matches)", id, len(matches))
+	}
+}
+
+// List returns all stored sessions, most recently updated first
+func (st *Store) List() ([]*Session, error) {
+	entries, err := os.ReadDir(st.dir)
+	if os.IsNotExist(err) {
+		return []*Session{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session directory: %w", err)
+	}
+
+	sessions := []*Session{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		s, err := st.read(filepath.Join(st.dir, entry.Name()))
+		if err != nil {
+			// Skip unreadable sessions
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+
+	return sessions, nil
+}
+
+func (st *Store) path(id string) string {
+	return filepath.Join(st.dir, id+".json")
+}
+
+func (st *Store) read(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %w", err)
+	}
+	return &s, nil
+}
@@ -0,0 +1,95 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxAliasDistance is the largest edit distance at which an unknown tool name is still
+// matched to a tool or alias
+const maxAliasDistance = 2
+
+// AddAlias lets models call a registered tool by another name
+func (r *Registry) AddAlias(alias, tool string) error {
+	if _, ok := r.tools[tool]; !ok {
+		return fmt.Errorf("alias '%s' refers to unknown tool '%s'", alias, tool)
+	}
+	if _, ok := r.tools[alias]; ok {
+		return fmt.Errorf("alias '%s' is already the name of a tool", alias)
+	}
+	r.aliases[alias] = tool
+	return nil
+}
+
+// Resolve maps the tool name a model used to a registered tool
+// The name is tried as is, as an alias and finally matched by edit distance against the
+// tool names and aliases, ignoring case and separators. If no tool matches, the name is
+// returned unchanged and ok is false
+func (r *Registry) Resolve(name string) (resolved string, ok bool) {
+	if _, ok := r.tools[name]; ok {
+		return name, true
+	}
+	if tool, ok := r.aliases[name]; ok {
+		return tool, true
+	}
+
+	key := normalizeToolName(name)
+	if key == "" {
+		return name, false
+	}
+	best, bestDist, tie := "", maxAliasDistance+1, false
+	consider := func(candidate, tool string) {
+		// Short names need a closer match, "ls" is not "ps"
+		limit := min(maxAliasDistance, (len(candidate)-1)/3)
+		d := editDistance(key, normalizeToolName(candidate))
+		switch {
+		case d > limit || d > bestDist:
+		case d < bestDist:
+			best, bestDist, tie = tool, d, false
+		case tool != best:
+			tie = true
+		}
+	}
+	for tool := range r.tools {
+		consider(tool, tool)
+	}
+	for alias, tool := range r.aliases {
+		consider(alias, tool)
+	}
+	if best == "" || tie {
+		return name, false
+	}
+	return best, true
+}
+
+// normalizeToolName lowercases a name and uses _ for every separator
+func normalizeToolName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.NewReplacer("-", "_", " ", "_", ".", "_").Replace(name)
+}
+
+// editDistance returns the optimal string alignment distance of a and b: the number of
+// insertions, deletions, substitutions and swaps of adjacent characters between them
+func editDistance(a, b string) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
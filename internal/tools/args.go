@@ -0,0 +1,35 @@
+package tools
+
+import (
+	"strconv"
+	"strings"
+)
+
+// boolArg reads a boolean argument
+// Models often send booleans as strings, so "true" and "yes" are accepted as well
+func boolArg(args map[string]any, key string) bool {
+	switch v := args[key].(type) {
+	case bool:
+		return v
+	case string:
+		v = strings.ToLower(strings.TrimSpace(v))
+		return v == "true" || v == "yes" || v == "1"
+	}
+	return false
+}
+
+// intArg reads an integer argument, returning def if it is missing or invalid
+// JSON numbers are decoded as float64 and models sometimes send numbers as strings
+func intArg(args map[string]any, key string, def int) int {
+	switch v := args[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case string:
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			return n
+		}
+	}
+	return def
+}
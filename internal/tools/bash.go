@@ -3,22 +3,41 @@ package tools
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/DanielNikkari/maahinen/internal/llm"
 )
 
+// cwdTrap makes the shell report its final directory on fd 3 so that cd persists between calls
+// It is put on the same line as the command to keep line numbers in error messages right
+const cwdTrap = "trap '{ pwd >&3; } 2>/dev/null' EXIT; "
+
 type BashTool struct {
-	workDir string
-	timeout time.Duration
+	workDir    string
+	timeout    time.Duration
+	maxTimeout time.Duration
+	maxOutput  int
+	sandbox    *Sandbox
+
+	// cwd is the shell's current directory, it follows cd in commands
+	mu  sync.Mutex
+	cwd string
 }
 
 func NewBashTool(workDir string) *BashTool {
 	return &BashTool{
-		workDir: workDir,
-		timeout: 30 * time.Second,
+		workDir:    workDir,
+		cwd:        workDir,
+		timeout:    30 * time.Second,
+		maxTimeout: 10 * time.Minute,
+		maxOutput:  30000,
 	}
 }
 
@@ -30,7 +49,16 @@ func (b *BashTool) Description() string {
 	return "Execute a bash command and return the output"
 }
 
+func (b *BashTool) Aliases() []string {
+	return []string{"go", "python", "shell", "sh", "cmd", "command", "terminal"}
+}
+
 func (b *BashTool) Execute(ctx context.Context, args map[string]any) (Result, error) {
+	return b.ExecuteStream(ctx, args, nil)
+}
+
+// ExecuteStream runs the command, passing each line of stdout and stderr to onOutput as it is printed
+func (b *BashTool) ExecuteStream(ctx context.Context, args map[string]any, onOutput func(line string)) (Result, error) {
 	command, ok := args["command"].(string)
 	if !ok || command == "" {
 		return Result{
@@ -39,25 +67,91 @@ func (b *BashTool) Execute(ctx context.Context, args map[string]any) (Result, er
 		}, nil
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, b.timeout)
-	defer cancel()
+	timeout := b.timeout
+	if secs := intArg(args, "timeout", 0); secs > 0 {
+		timeout = min(time.Duration(secs)*time.Second, b.maxTimeout)
+	}
 
-	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	// A cwd argument only applies to this call, otherwise the command runs in the
+	// shell's current directory and a cd in it carries over to later calls
+	var notes []string
+	dir, persist := b.CurrentDir(), true
+	if arg, _ := args["cwd"].(string); arg != "" {
+		dir, persist = resolveDir(dir, arg), false
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return Result{
+				Success: false,
+				Error:   fmt.Sprintf("cwd %s does not exist or is not a directory", dir),
+			}, nil
+		}
+	} else if info, err := os.Stat(dir); dir != b.workDir && (err != nil || !info.IsDir()) {
+		notes = append(notes, fmt.Sprintf("Note: %s no longer exists, the command ran in %s", dir, b.workDir))
+		dir = b.workDir
+		b.setCurrentDir(dir)
+	}
 
-	if b.workDir != "" {
-		cmd.Dir = b.workDir
+	// The shell writes its final directory to this file
+	cwdFile, err := os.CreateTemp("", "maahinen-cwd-")
+	if err != nil {
+		return Result{
+			Success: false,
+			Error:   fmt.Sprintf("failed to create temp file: %v", err),
+		}, nil
 	}
+	defer os.Remove(cwdFile.Name())
+	defer cwdFile.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if b.sandbox != nil {
+		cmd = b.sandbox.command(ctx, cwdTrap+command, dir)
+	} else {
+		cmd = exec.CommandContext(ctx, "bash", "-c", cwdTrap+command)
+		cmd.Dir = dir
+	}
+	cmd.ExtraFiles = []*os.File{cwdFile}
+	SetProcessGroup(cmd)
+	// Don't wait forever on output pipes held open by orphaned children
+	cmd.WaitDelay = 2 * time.Second
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+	if onOutput != nil {
+		// Both streams share the callback, lines are passed on in the order they complete
+		var mu sync.Mutex
+		outLines := &lineWriter{mu: &mu, fn: onOutput}
+		errLines := &lineWriter{mu: &mu, fn: onOutput}
+		cmd.Stdout = io.MultiWriter(&stdout, outLines)
+		cmd.Stderr = io.MultiWriter(&stderr, errLines)
+		defer outLines.Flush()
+		defer errLines.Flush()
+	}
+
+	err = cmd.Run()
 
-	err := cmd.Run()
+	if persist {
+		if data, readErr := os.ReadFile(cwdFile.Name()); readErr == nil {
+			if newDir := strings.TrimSpace(string(data)); newDir != "" && newDir != dir {
+				b.setCurrentDir(newDir)
+				notes = append(notes, "Working directory is now "+newDir)
+			}
+		}
+	}
 
-	output := strings.TrimSpace(stdout.String())
-	errOutput := strings.TrimSpace(stderr.String())
+	output := b.truncate(strings.TrimSpace(stdout.String()))
+	errOutput := b.truncate(strings.TrimSpace(stderr.String()))
 
 	if err != nil {
+		switch ctx.Err() {
+		case context.Canceled:
+			err = fmt.Errorf("command cancelled")
+		case context.DeadlineExceeded:
+			err = fmt.Errorf("command timed out after %s, pass a longer timeout (up to %d seconds) or use bash_background for long-running commands", timeout, int(b.maxTimeout.Seconds()))
+		}
+
 		combinedOutput := output
 		if errOutput != "" {
 			if combinedOutput != "" {
@@ -68,7 +162,7 @@ func (b *BashTool) Execute(ctx context.Context, args map[string]any) (Result, er
 
 		return Result{
 			Success: false,
-			Output:  combinedOutput,
+			Output:  withNotes(combinedOutput, notes),
 			Error:   err.Error(),
 		}, nil
 	}
@@ -81,16 +175,114 @@ func (b *BashTool) Execute(ctx context.Context, args map[string]any) (Result, er
 
 	return Result{
 		Success: true,
-		Output:  output,
+		Output:  withNotes(output, notes),
 	}, nil
 }
 
+// CurrentDir returns the shell's current directory, which follows cd in commands
+func (b *BashTool) CurrentDir() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cwd
+}
+
+func (b *BashTool) setCurrentDir(dir string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cwd = dir
+}
+
+// truncate shortens output longer than maxOutput, keeping its beginning and end
+func (b *BashTool) truncate(output string) string {
+	if b.maxOutput <= 0 || len(output) <= b.maxOutput {
+		return output
+	}
+	head := b.maxOutput / 2
+	tail := b.maxOutput - head
+	return fmt.Sprintf("%s\n... (%d characters truncated) ...\n%s", output[:head], len(output)-b.maxOutput, output[len(output)-tail:])
+}
+
+// resolveDir resolves a directory argument relative to the current directory
+func resolveDir(cwd, dir string) string {
+	dir = expandHome(dir)
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(cwd, dir)
+	}
+	return filepath.Clean(dir)
+}
+
+func withNotes(output string, notes []string) string {
+	if len(notes) == 0 {
+		return output
+	}
+	if output != "" {
+		output += "\n"
+	}
+	return output + strings.Join(notes, "\n")
+}
+
+// lineWriter passes complete lines written to it to fn
+type lineWriter struct {
+	mu      *sync.Mutex
+	fn      func(string)
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.fn(strings.TrimRight(string(w.partial[:i]), "\r"))
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush passes on a last line without a trailing newline
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.partial) > 0 {
+		w.fn(string(w.partial))
+		w.partial = nil
+	}
+}
+
 func (b *BashTool) SetTimeout(d time.Duration) {
 	b.timeout = d
 }
 
+// SetMaxTimeout sets the longest timeout a call can ask for
+func (b *BashTool) SetMaxTimeout(d time.Duration) {
+	b.maxTimeout = d
+}
+
+// SetMaxOutput sets how many characters of stdout and stderr are returned, 0 for no limit
+func (b *BashTool) SetMaxOutput(n int) {
+	b.maxOutput = n
+}
+
+// SetWorkDir sets the directory commands start in, resetting the current directory
 func (b *BashTool) SetWorkDir(dir string) {
 	b.workDir = dir
+	b.setCurrentDir(dir)
+}
+
+// ResetSession goes back to the starting directory for a new conversation
+func (b *BashTool) ResetSession() {
+	b.setCurrentDir(b.workDir)
+}
+
+// SetSandbox runs commands in the sandbox, nil runs them directly on the host
+func (b *BashTool) SetSandbox(s *Sandbox) {
+	b.sandbox = s
 }
 
 func BashToolDefinition() llm.Tool {
@@ -98,7 +290,7 @@ func BashToolDefinition() llm.Tool {
 		Type: "function",
 		Function: llm.ToolDefinition{
 			Name:        "bash",
-			Description: "Execute a bash command on the system. Use this to run shell commands, check files, install packages, etc.",
+			Description: "Execute a bash command on the system. Use this to run shell commands, check files, install packages, etc. The working directory persists between calls, so cd works like in a terminal.",
 			Parameters: llm.Parameters{
 				Type: "object",
 				Properties: map[string]llm.Property{
@@ -106,6 +298,15 @@ func BashToolDefinition() llm.Tool {
 						Type:        "string",
 						Description: "The bash command to execute",
 					},
+					"timeout": {
+						Type:        "integer",
+						Description: "Timeout in seconds (optional, for commands that take longer than usual)",
+						Minimum:     llm.Bound(1),
+					},
+					"cwd": {
+						Type:        "string",
+						Description: "Directory to run this command in (optional), relative to the current directory. Does not change the directory for later commands",
+					},
 				},
 				Required: []string{"command"},
 			},
@@ -114,5 +315,12 @@ func BashToolDefinition() llm.Tool {
 }
 
 func (b *BashTool) Definition() llm.Tool {
-	return BashToolDefinition()
+	def := BashToolDefinition()
+	timeout := def.Function.Parameters.Properties["timeout"]
+	timeout.Description = fmt.Sprintf("Timeout in seconds, default %d, at most %d (optional)", int(b.timeout.Seconds()), int(b.maxTimeout.Seconds()))
+	def.Function.Parameters.Properties["timeout"] = timeout
+	if b.sandbox != nil {
+		def.Function.Description += " " + b.sandbox.note()
+	}
+	return def
 }
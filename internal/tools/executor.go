@@ -13,6 +13,34 @@ type Tool interface {
 	Execute(ctx context.Context, args map[string]any) (Result, error)
 }
 
+// ReadOnlyTool is implemented by tools that can declare themselves free of side effects
+// Read-only calls requested in the same model turn may run concurrently
+type ReadOnlyTool interface {
+	ReadOnly() bool
+}
+
+// IsReadOnly reports whether the tool declares itself free of side effects
+func IsReadOnly(t Tool) bool {
+	ro, ok := t.(ReadOnlyTool)
+	return ok && ro.ReadOnly()
+}
+
+// StreamingTool is implemented by tools that can report output while they run
+// onOutput is called with each complete line of output, possibly from another goroutine
+type StreamingTool interface {
+	ExecuteStream(ctx context.Context, args map[string]any, onOutput func(line string)) (Result, error)
+}
+
+// AliasedTool is implemented by tools that declare other names models commonly call them by
+type AliasedTool interface {
+	Aliases() []string
+}
+
+// SessionTool is implemented by tools that keep state for the current conversation
+type SessionTool interface {
+	ResetSession()
+}
+
 type Result struct {
 	Success bool   `json:"success"`
 	Output  string `json:"output"`
@@ -21,16 +49,28 @@ type Result struct {
 
 type Registry struct {
 	tools map[string]Tool
+	// aliases maps other names models use for tools to the tool names
+	aliases map[string]string
 }
 
 func NewRegistry() *Registry {
 	return &Registry{
-		tools: make(map[string]Tool),
+		tools:   make(map[string]Tool),
+		aliases: make(map[string]string),
 	}
 }
 
+// Register adds a tool along with the aliases it declares
+// An alias already declared by an earlier tool is kept
 func (r *Registry) Register(t Tool) {
 	r.tools[t.Name()] = t
+	if at, ok := t.(AliasedTool); ok {
+		for _, alias := range at.Aliases() {
+			if _, taken := r.aliases[alias]; !taken {
+				r.aliases[alias] = t.Name()
+			}
+		}
+	}
 }
 
 func (r *Registry) Get(name string) (Tool, bool) {
@@ -49,3 +89,12 @@ func (r *Registry) List() []string {
 func (r *Registry) All() map[string]Tool {
 	return r.tools
 }
+
+// ResetSession clears the conversation state of the tools that keep any
+func (r *Registry) ResetSession() {
+	for _, t := range r.tools {
+		if st, ok := t.(SessionTool); ok {
+			st.ResetSession()
+		}
+	}
+}
@@ -1,25 +1,40 @@
 package tools
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/DanielNikkari/maahinen/internal/llm"
 )
 
+const (
+	// Lines returned by the read tool when no limit is given
+	readDefaultLimit = 2000
+	// Longest output the read tool returns in one call
+	readMaxOutput = 100000
+	// Longest line the read tool returns
+	readMaxLineLength = 2000
+)
+
 type ReadTool struct {
-	workDir string
+	ws *Workspace
 }
 
-func NewReadTool(workDir string) *ReadTool {
-	return &ReadTool{workDir: workDir}
+func NewReadTool(ws *Workspace) *ReadTool {
+	return &ReadTool{ws: ws}
 }
 
 func (t *ReadTool) Name() string        { return "read" }
 func (t *ReadTool) Description() string { return "Read the contents of a file" }
+func (t *ReadTool) Aliases() []string   { return []string{"file_read", "read_file"} }
 
 func (t *ReadTool) Execute(ctx context.Context, args map[string]any) (Result, error) {
 	path, ok := args["path"].(string)
@@ -27,24 +42,95 @@ func (t *ReadTool) Execute(ctx context.Context, args map[string]any) (Result, er
 		return Result{Success: false, Error: "missing 'path' argument"}, nil
 	}
 
-	if !filepath.IsAbs(path) && t.workDir != "" {
-		path = filepath.Join(t.workDir, path)
+	offset := max(intArg(args, "offset", 1), 1)
+	limit := intArg(args, "limit", readDefaultLimit)
+	if limit <= 0 {
+		limit = readDefaultLimit
 	}
 
-	content, err := os.ReadFile(path)
+	path, err := t.ws.Resolve(path)
+	if err != nil {
+		return Result{Success: false, Error: err.Error()}, nil
+	}
+
+	f, err := os.Open(path)
 	if err != nil {
 		return Result{Success: false, Error: err.Error()}, nil
 	}
+	defer f.Close()
 
-	return Result{Success: true, Output: string(content)}, nil
+	info, err := f.Stat()
+	if err != nil {
+		return Result{Success: false, Error: err.Error()}, nil
+	}
+	if info.IsDir() {
+		return Result{Success: false, Error: fmt.Sprintf("%s is a directory, use the list tool instead", path)}, nil
+	}
+
+	// Describe binary files instead of returning garbage
+	head := make([]byte, 8000)
+	n, _ := io.ReadFull(f, head)
+	if isBinary(head[:n]) {
+		return Result{
+			Success: true,
+			Output:  fmt.Sprintf("Binary file (%s, %d bytes), content not shown", http.DetectContentType(head[:n]), info.Size()),
+		}, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return Result{Success: false, Error: err.Error()}, nil
+	}
+
+	var sb strings.Builder
+	lineNum, shown, last := 0, 0, 0
+	truncated := false
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadString('\n')
+		if line == "" && err != nil {
+			break
+		}
+		lineNum++
+
+		if lineNum >= offset && !truncated {
+			if shown == limit || sb.Len() >= readMaxOutput {
+				truncated = true
+			} else {
+				line = strings.TrimRight(line, "\r\n")
+				if len(line) > readMaxLineLength {
+					line = line[:readMaxLineLength] + "... (line truncated)"
+				}
+				fmt.Fprintf(&sb, "%6d\t%s\n", lineNum, line)
+				shown++
+				last = lineNum
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	switch {
+	case lineNum == 0:
+		return Result{Success: true, Output: "(empty file)"}, nil
+	case shown == 0:
+		return Result{Success: false, Error: fmt.Sprintf("offset %d is past the end of the file (%d lines)", offset, lineNum)}, nil
+	}
+
+	output := strings.TrimRight(sb.String(), "\n")
+	if truncated {
+		output += fmt.Sprintf("\n... showing lines %d-%d of %d. Use offset=%d to read more.", offset, last, lineNum, last+1)
+	}
+
+	return Result{Success: true, Output: output}, nil
 }
 
 func ReadToolDefinition() llm.Tool {
 	return llm.Tool{
 		Type: "function",
 		Function: llm.ToolDefinition{
-			Name:        "read",
-			Description: "Read the contents of a file",
+			Name: "read",
+			Description: "Read the contents of a file. Each line is prefixed with its line number and a tab, " +
+				"the prefix is not part of the file. Large files are returned in chunks, use offset and limit to read further.",
 			Parameters: llm.Parameters{
 				Type: "object",
 				Properties: map[string]llm.Property{
@@ -52,6 +138,16 @@ func ReadToolDefinition() llm.Tool {
 						Type:        "string",
 						Description: "Path to the file to read",
 					},
+					"offset": {
+						Type:        "integer",
+						Description: "Line number to start reading from (1-based, defaults to 1)",
+						Minimum:     llm.Bound(1),
+					},
+					"limit": {
+						Type:        "integer",
+						Description: fmt.Sprintf("Maximum number of lines to read (defaults to %d)", readDefaultLimit),
+						Minimum:     llm.Bound(1),
+					},
 				},
 				Required: []string{"path"},
 			},
@@ -60,15 +156,16 @@ func ReadToolDefinition() llm.Tool {
 }
 
 type WriteTool struct {
-	workDir string
+	ws *Workspace
 }
 
-func NewWriteTool(workDir string) *WriteTool {
-	return &WriteTool{workDir: workDir}
+func NewWriteTool(ws *Workspace) *WriteTool {
+	return &WriteTool{ws: ws}
 }
 
 func (t *WriteTool) Name() string        { return "write" }
 func (t *WriteTool) Description() string { return "Create or overwrite a file with content" }
+func (t *WriteTool) Aliases() []string   { return []string{"file_write", "write_file", "create_file"} }
 
 func (t *WriteTool) Execute(ctx context.Context, args map[string]any) (Result, error) {
 	path, ok := args["path"].(string)
@@ -81,8 +178,9 @@ func (t *WriteTool) Execute(ctx context.Context, args map[string]any) (Result, e
 		return Result{Success: false, Error: "missing 'content' argument"}, nil
 	}
 
-	if !filepath.IsAbs(path) && t.workDir != "" {
-		path = filepath.Join(t.workDir, path)
+	path, err := t.ws.Resolve(path)
+	if err != nil {
+		return Result{Success: false, Error: err.Error()}, nil
 	}
 
 	dir := filepath.Dir(path)
@@ -122,15 +220,16 @@ func WriteToolDefinition() llm.Tool {
 }
 
 type EditTool struct {
-	workDir string
+	ws *Workspace
 }
 
-func NewEditTool(workDir string) *EditTool {
-	return &EditTool{workDir: workDir}
+func NewEditTool(ws *Workspace) *EditTool {
+	return &EditTool{ws: ws}
 }
 
 func (t *EditTool) Name() string        { return "edit" }
 func (t *EditTool) Description() string { return "Edit a file by replacing a specific string" }
+func (t *EditTool) Aliases() []string   { return []string{"file_edit", "edit_file"} }
 
 func (t *EditTool) Execute(ctx context.Context, args map[string]any) (Result, error) {
 	path, ok := args["path"].(string)
@@ -138,15 +237,14 @@ func (t *EditTool) Execute(ctx context.Context, args map[string]any) (Result, er
 		return Result{Success: false, Error: "missing 'path' argument"}, nil
 	}
 
-	oldStr, ok := args["old_string"].(string)
-	if !ok || oldStr == "" {
-		return Result{Success: false, Error: "missing 'old_string' argument"}, nil
+	edits, err := editsArg(args)
+	if err != nil {
+		return Result{Success: false, Error: err.Error()}, nil
 	}
 
-	newStr, _ := args["new_string"].(string) // Can be empty (deletion)
-
-	if !filepath.IsAbs(path) && t.workDir != "" {
-		path = filepath.Join(t.workDir, path)
+	path, err = t.ws.Resolve(path)
+	if err != nil {
+		return Result{Success: false, Error: err.Error()}, nil
 	}
 
 	content, err := os.ReadFile(path)
@@ -154,27 +252,190 @@ func (t *EditTool) Execute(ctx context.Context, args map[string]any) (Result, er
 		return Result{Success: false, Error: err.Error()}, nil
 	}
 
+	// All edits are applied in memory so the file is only written if every one of them succeeds
 	contentStr := string(content)
+	var notes []string
+	replacements := 0
+	for i, e := range edits {
+		var n int
+		var note string
+		contentStr, n, note, err = applyEdit(contentStr, e)
+		if err != nil {
+			if len(edits) > 1 {
+				err = fmt.Errorf("edit %d: %v (no edits were applied)", i+1, err)
+			}
+			return Result{Success: false, Error: err.Error()}, nil
+		}
+		replacements += n
+		if note != "" {
+			if len(edits) > 1 {
+				note = fmt.Sprintf("edit %d: %s", i+1, note)
+			}
+			notes = append(notes, note)
+		}
+	}
 
-	if !strings.Contains(contentStr, oldStr) {
-		return Result{Success: false, Error: "old_string not found in file"}, nil
+	if err := os.WriteFile(path, []byte(contentStr), 0644); err != nil {
+		return Result{Success: false, Error: err.Error()}, nil
 	}
 
-	newContent := strings.Replace(contentStr, oldStr, newStr, 1)
+	output := fmt.Sprintf("File edited: %s", path)
+	if replacements > 1 {
+		output += fmt.Sprintf(" (%d replacements)", replacements)
+	}
+	for _, note := range notes {
+		output += "\nNote: " + note
+	}
+	return Result{Success: true, Output: output}, nil
+}
 
-	if err := os.WriteFile(path, []byte(newContent), 0644); err != nil {
-		return Result{Success: false, Error: err.Error()}, nil
+// edit is a single replacement made by the edit tool
+type edit struct {
+	oldStr     string
+	newStr     string
+	replaceAll bool
+}
+
+// editsArg reads either the edits list or a single old_string/new_string pair
+func editsArg(args map[string]any) ([]edit, error) {
+	list, ok := args["edits"].([]any)
+	if !ok || len(list) == 0 {
+		e, err := editFromArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		return []edit{e}, nil
 	}
 
-	return Result{Success: true, Output: fmt.Sprintf("File edited: %s", path)}, nil
+	edits := make([]edit, 0, len(list))
+	for i, item := range list {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("edit %d: expected an object with old_string and new_string", i+1)
+		}
+		e, err := editFromArgs(m)
+		if err != nil {
+			return nil, fmt.Errorf("edit %d: %v", i+1, err)
+		}
+		edits = append(edits, e)
+	}
+	return edits, nil
+}
+
+func editFromArgs(args map[string]any) (edit, error) {
+	oldStr, ok := args["old_string"].(string)
+	if !ok || oldStr == "" {
+		return edit{}, fmt.Errorf("missing 'old_string' argument")
+	}
+	newStr, _ := args["new_string"].(string) // Can be empty (deletion)
+	return edit{oldStr: oldStr, newStr: newStr, replaceAll: boolArg(args, "replace_all")}, nil
+}
+
+// applyEdit makes one edit to content
+// An exact match is preferred. Without one, old_string is matched ignoring differences in
+// whitespace and a note saying so is returned
+// Returns the new content and the number of replacements
+func applyEdit(content string, e edit) (string, int, string, error) {
+	oldStr, newStr := e.oldStr, e.newStr
+	if strings.Contains(content, "\r\n") && !strings.Contains(oldStr, "\r\n") {
+		// Models write \n line endings, keep the file's own
+		oldStr = strings.ReplaceAll(oldStr, "\n", "\r\n")
+		newStr = strings.ReplaceAll(newStr, "\n", "\r\n")
+	}
+
+	if n := strings.Count(content, oldStr); n > 0 {
+		if n > 1 && !e.replaceAll {
+			return "", 0, "", ambiguousError(content, exactMatches(content, oldStr))
+		}
+		if e.replaceAll {
+			return strings.ReplaceAll(content, oldStr, newStr), n, "", nil
+		}
+		return strings.Replace(content, oldStr, newStr, 1), 1, "", nil
+	}
+
+	re := whitespaceInsensitive(oldStr)
+	if re == nil {
+		return "", 0, "", fmt.Errorf("old_string not found in file")
+	}
+	matches := re.FindAllStringIndex(content, -1)
+	if len(matches) == 0 {
+		return "", 0, "", fmt.Errorf("old_string not found in file")
+	}
+	if len(matches) > 1 && !e.replaceAll {
+		return "", 0, "", ambiguousError(content, matches)
+	}
+
+	// The match starts after the indentation of old_string, which the file keeps
+	if strings.TrimLeft(oldStr, " \t") != oldStr {
+		newStr = strings.TrimLeft(newStr, " \t")
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		sb.WriteString(content[last:m[0]])
+		sb.WriteString(newStr)
+		last = m[1]
+	}
+	sb.WriteString(content[last:])
+
+	note := fmt.Sprintf("no exact match, old_string matched ignoring whitespace at %s", describeLines(content, matches))
+	return sb.String(), len(matches), note, nil
+}
+
+// whitespaceInsensitive returns a regex matching s with any run of whitespace in place of
+// the whitespace in s, or nil if s is only whitespace
+func whitespaceInsensitive(s string) *regexp.Regexp {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return nil
+	}
+	for i, w := range words {
+		words[i] = regexp.QuoteMeta(w)
+	}
+	return regexp.MustCompile(strings.Join(words, `\s+`))
+}
+
+func exactMatches(content, s string) [][]int {
+	var matches [][]int
+	for i := 0; ; {
+		j := strings.Index(content[i:], s)
+		if j < 0 {
+			return matches
+		}
+		matches = append(matches, []int{i + j, i + j + len(s)})
+		i += j + len(s)
+	}
+}
+
+func ambiguousError(content string, matches [][]int) error {
+	return fmt.Errorf("old_string matches %d times (at %s). Include more surrounding context to make it unique, or set replace_all to replace every match",
+		len(matches), describeLines(content, matches))
+}
+
+// describeLines lists the line numbers where matches start
+func describeLines(content string, matches [][]int) string {
+	var lines []string
+	for i, m := range matches {
+		if i == 10 {
+			lines = append(lines, "...")
+			break
+		}
+		lines = append(lines, strconv.Itoa(strings.Count(content[:m[0]], "\n")+1))
+	}
+	if len(matches) == 1 {
+		return "line " + lines[0]
+	}
+	return "lines " + strings.Join(lines, ", ")
 }
 
 func EditToolDefinition() llm.Tool {
 	return llm.Tool{
 		Type: "function",
 		Function: llm.ToolDefinition{
-			Name:        "edit",
-			Description: "Edit a file by finding and replacing a specific string",
+			Name: "edit",
+			Description: "Edit a file by finding and replacing a specific string. old_string must match exactly once unless replace_all is set. " +
+				"Use edits to make several replacements in one file at once, they are applied in order and all succeed or none are made.",
 			Parameters: llm.Parameters{
 				Type: "object",
 				Properties: map[string]llm.Property{
@@ -184,29 +445,47 @@ func EditToolDefinition() llm.Tool {
 					},
 					"old_string": {
 						Type:        "string",
-						Description: "The exact string to find and replace",
+						Description: "The exact string to find and replace, include enough context to make it unique",
 					},
 					"new_string": {
 						Type:        "string",
 						Description: "The string to replace it with (empty to delete)",
 					},
+					"replace_all": {
+						Type:        "boolean",
+						Description: "Replace every occurrence of old_string instead of requiring a unique match",
+					},
+					"edits": {
+						Type:        "array",
+						Description: "Replacements to apply in order instead of a single old_string/new_string",
+						Items: &llm.Property{
+							Type: "object",
+							Properties: map[string]llm.Property{
+								"old_string":  {Type: "string", Description: "The exact string to find and replace"},
+								"new_string":  {Type: "string", Description: "The string to replace it with (empty to delete)"},
+								"replace_all": {Type: "boolean", Description: "Replace every occurrence of old_string"},
+							},
+							Required: []string{"old_string", "new_string"},
+						},
+					},
 				},
-				Required: []string{"path", "old_string", "new_string"},
+				Required: []string{"path"},
 			},
 		},
 	}
 }
 
 type ListTool struct {
-	workDir string
+	ws *Workspace
 }
 
-func NewListTool(workDir string) *ListTool {
-	return &ListTool{workDir: workDir}
+func NewListTool(ws *Workspace) *ListTool {
+	return &ListTool{ws: ws}
 }
 
 func (t *ListTool) Name() string        { return "list" }
 func (t *ListTool) Description() string { return "List files and directories in a path" }
+func (t *ListTool) Aliases() []string   { return []string{"file_list", "list_files", "ls", "dir"} }
 
 func (t *ListTool) Execute(ctx context.Context, args map[string]any) (Result, error) {
 	path, ok := args["path"].(string)
@@ -214,8 +493,9 @@ func (t *ListTool) Execute(ctx context.Context, args map[string]any) (Result, er
 		path = "."
 	}
 
-	if !filepath.IsAbs(path) && t.workDir != "" {
-		path = filepath.Join(t.workDir, path)
+	path, err := t.ws.Resolve(path)
+	if err != nil {
+		return Result{Success: false, Error: err.Error()}, nil
 	}
 
 	entries, err := os.ReadDir(path)
@@ -275,3 +555,6 @@ func (t *EditTool) Definition() llm.Tool {
 func (t *ListTool) Definition() llm.Tool {
 	return ListToolDefinition()
 }
+
+func (t *ReadTool) ReadOnly() bool { return true }
+func (t *ListTool) ReadOnly() bool { return true }
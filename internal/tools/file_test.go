@@ -0,0 +1,235 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// numbered formats lines the way the read tool shows them
+func numbered(first int, lines ...string) string {
+	var out []string
+	for i, line := range lines {
+		out = append(out, fmt.Sprintf("%6d\t%s", first+i, line))
+	}
+	return strings.Join(out, "\n")
+}
+
+func TestRead(t *testing.T) {
+	files := map[string]string{
+		"five.txt":    "l1\nl2\nl3\nl4\nl5\n",
+		"noeol.txt":   "a\nb",
+		"crlf.txt":    "a\r\nb\r\n",
+		"empty.txt":   "",
+		"long.txt":    strings.Repeat("x", readMaxLineLength+5) + "\n",
+		"binary.bin":  "\x89PNG\r\n\x1a\n\x00\x00",
+		"dir/inner.c": "int x;\n",
+	}
+
+	tests := []struct {
+		name string
+		args map[string]any
+		want string
+		err  string
+	}{
+		{
+			name: "whole file",
+			args: map[string]any{"path": "five.txt"},
+			want: numbered(1, "l1", "l2", "l3", "l4", "l5"),
+		},
+		{
+			name: "offset and limit",
+			args: map[string]any{"path": "five.txt", "offset": 2, "limit": 2},
+			want: numbered(2, "l2", "l3") + "\n... showing lines 2-3 of 5. Use offset=4 to read more.",
+		},
+		{
+			name: "limit reaching the last line",
+			args: map[string]any{"path": "five.txt", "offset": 4, "limit": 2},
+			want: numbered(4, "l4", "l5"),
+		},
+		{
+			name: "limit past the end",
+			args: map[string]any{"path": "five.txt", "offset": 5, "limit": 10},
+			want: numbered(5, "l5"),
+		},
+		{
+			name: "offset below one starts at the first line",
+			args: map[string]any{"path": "five.txt", "offset": 0, "limit": 1},
+			want: numbered(1, "l1") + "\n... showing lines 1-1 of 5. Use offset=2 to read more.",
+		},
+		{
+			name: "zero limit uses the default",
+			args: map[string]any{"path": "five.txt", "offset": 3, "limit": 0},
+			want: numbered(3, "l3", "l4", "l5"),
+		},
+		{
+			name: "offset past the end",
+			args: map[string]any{"path": "five.txt", "offset": 6},
+			err:  "offset 6 is past the end of the file (5 lines)",
+		},
+		{
+			name: "no newline at the end",
+			args: map[string]any{"path": "noeol.txt"},
+			want: numbered(1, "a", "b"),
+		},
+		{
+			name: "crlf line endings",
+			args: map[string]any{"path": "crlf.txt"},
+			want: numbered(1, "a", "b"),
+		},
+		{
+			name: "empty file",
+			args: map[string]any{"path": "empty.txt"},
+			want: "(empty file)",
+		},
+		{
+			name: "long line",
+			args: map[string]any{"path": "long.txt"},
+			want: numbered(1, strings.Repeat("x", readMaxLineLength)+"... (line truncated)"),
+		},
+		{
+			name: "binary file",
+			args: map[string]any{"path": "binary.bin"},
+			want: "Binary file (image/png, 10 bytes), content not shown",
+		},
+		{
+			name: "directory",
+			args: map[string]any{"path": "dir"},
+			err:  "is a directory",
+		},
+	}
+
+	tool := NewReadTool(newTestWorkspace(t, files))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tool.Execute(context.Background(), tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.err != "" {
+				if result.Success || !strings.Contains(result.Error, tt.err) {
+					t.Errorf("result %+v, want an error containing %q", result, tt.err)
+				}
+				return
+			}
+			if !result.Success {
+				t.Fatalf("read failed: %s", result.Error)
+			}
+			if result.Output != tt.want {
+				t.Errorf("output:\n%s\nwant:\n%s", result.Output, tt.want)
+			}
+		})
+	}
+}
+
+func TestEdit(t *testing.T) {
+	const code = "func a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 1\n}\n"
+
+	tests := []struct {
+		name    string
+		content string
+		args    map[string]any
+		want    string
+		note    string
+		err     string
+	}{
+		{
+			name:    "unique match",
+			content: code,
+			args:    map[string]any{"old_string": "func a() {\n\treturn 1", "new_string": "func a() {\n\treturn 2"},
+			want:    "func a() {\n\treturn 2\n}\n\nfunc b() {\n\treturn 1\n}\n",
+		},
+		{
+			name:    "ambiguous match",
+			content: code,
+			args:    map[string]any{"old_string": "return 1", "new_string": "return 2"},
+			err:     "old_string matches 2 times (at lines 2, 6)",
+		},
+		{
+			name:    "replace all",
+			content: code,
+			args:    map[string]any{"old_string": "return 1", "new_string": "return 2", "replace_all": true},
+			want:    "func a() {\n\treturn 2\n}\n\nfunc b() {\n\treturn 2\n}\n",
+		},
+		{
+			name:    "not found",
+			content: code,
+			args:    map[string]any{"old_string": "return 3", "new_string": "return 2"},
+			err:     "old_string not found in file",
+		},
+		{
+			name:    "whitespace fallback keeps the file's indentation",
+			content: code,
+			args:    map[string]any{"old_string": "    return 1\n}\n\nfunc b", "new_string": "    return 3\n}\n\nfunc b"},
+			want:    "func a() {\n\treturn 3\n}\n\nfunc b() {\n\treturn 1\n}\n",
+			note:    "matched ignoring whitespace at line 2",
+		},
+		{
+			name:    "whitespace fallback ambiguous",
+			content: code,
+			args:    map[string]any{"old_string": "return  1", "new_string": "return 2"},
+			err:     "old_string matches 2 times",
+		},
+		{
+			name:    "crlf file with lf old_string",
+			content: "one\r\ntwo\r\n",
+			args:    map[string]any{"old_string": "one\ntwo", "new_string": "1\n2"},
+			want:    "1\r\n2\r\n",
+		},
+		{
+			name:    "edits applied in order",
+			content: code,
+			args: map[string]any{"edits": []any{
+				map[string]any{"old_string": "func a", "new_string": "func x"},
+				map[string]any{"old_string": "func x() {\n\treturn 1", "new_string": "func x() {\n\treturn 0"},
+			}},
+			want: "func x() {\n\treturn 0\n}\n\nfunc b() {\n\treturn 1\n}\n",
+		},
+		{
+			name:    "failing edit leaves the file unchanged",
+			content: code,
+			args: map[string]any{"edits": []any{
+				map[string]any{"old_string": "func a", "new_string": "func x"},
+				map[string]any{"old_string": "func c", "new_string": "func y"},
+			}},
+			err: "edit 2: old_string not found in file (no edits were applied)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newTestWorkspace(t, map[string]string{"f.go": tt.content})
+			tt.args["path"] = "f.go"
+			result, err := NewEditTool(ws).Execute(context.Background(), tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(ws.Root(), "f.go"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.err != "" {
+				if result.Success || !strings.Contains(result.Error, tt.err) {
+					t.Errorf("result %+v, want an error containing %q", result, tt.err)
+				}
+				if string(data) != tt.content {
+					t.Errorf("file changed by a failed edit: %q", data)
+				}
+				return
+			}
+			if !result.Success {
+				t.Fatalf("edit failed: %s", result.Error)
+			}
+			if string(data) != tt.want {
+				t.Errorf("file %q, want %q", data, tt.want)
+			}
+			if tt.note != "" && !strings.Contains(result.Output, tt.note) {
+				t.Errorf("output %q, want a note containing %q", result.Output, tt.note)
+			}
+		})
+	}
+}
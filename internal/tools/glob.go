@@ -0,0 +1,132 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DanielNikkari/maahinen/internal/llm"
+)
+
+// Most files listed by a glob call
+const globMaxResults = 100
+
+type GlobTool struct {
+	ws *Workspace
+}
+
+func NewGlobTool(ws *Workspace) *GlobTool {
+	return &GlobTool{ws: ws}
+}
+
+func (t *GlobTool) Name() string        { return "glob" }
+func (t *GlobTool) Description() string { return "Find files by name pattern" }
+func (t *GlobTool) Aliases() []string {
+	return []string{"find", "find_files", "file_search", "glob_files"}
+}
+
+func (t *GlobTool) Execute(ctx context.Context, args map[string]any) (Result, error) {
+	pattern, ok := args["pattern"].(string)
+	if !ok || pattern == "" {
+		return Result{Success: false, Error: "missing 'pattern' argument"}, nil
+	}
+	patterns := []string{filepath.ToSlash(pattern)}
+
+	path, ok := args["path"].(string)
+	if !ok || path == "" {
+		path = "."
+	}
+	root, err := t.ws.Resolve(path)
+	if err != nil {
+		return Result{Success: false, Error: err.Error()}, nil
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return Result{Success: false, Error: err.Error()}, nil
+	}
+	if !info.IsDir() {
+		return Result{Success: false, Error: fmt.Sprintf("%s is not a directory", path)}, nil
+	}
+
+	type match struct {
+		path    string
+		modTime time.Time
+	}
+	var matches []match
+
+	err = walkWorkspace(ctx, root, func(rel string, d fs.DirEntry) error {
+		if !matchAnyGlob(patterns, rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		matches = append(matches, match{
+			path:    filepath.ToSlash(filepath.Join(path, rel)),
+			modTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return Result{Success: false, Error: err.Error()}, nil
+	}
+
+	if len(matches) == 0 {
+		return Result{Success: true, Output: "No files found"}, nil
+	}
+
+	// Most recently modified first, these are usually the files being worked on
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].modTime.After(matches[j].modTime)
+	})
+
+	var lines []string
+	for i, m := range matches {
+		if i == globMaxResults {
+			lines = append(lines, fmt.Sprintf("... %d more results, use a more specific pattern or path", len(matches)-globMaxResults))
+			break
+		}
+		lines = append(lines, m.path)
+	}
+
+	return Result{Success: true, Output: strings.Join(lines, "\n")}, nil
+}
+
+func GlobToolDefinition() llm.Tool {
+	return llm.Tool{
+		Type: "function",
+		Function: llm.ToolDefinition{
+			Name: "glob",
+			Description: "Find files by name pattern in the whole directory tree, most recently modified first. " +
+				"Skips .git, node_modules, vendor and files ignored by .gitignore.",
+			Parameters: llm.Parameters{
+				Type: "object",
+				Properties: map[string]llm.Property{
+					"pattern": {
+						Type: "string",
+						Description: "Glob pattern. ** matches any number of directories, e.g. \"**/*_test.go\" or \"cmd/**/main.go\". " +
+							"A pattern without a slash like \"*.go\" matches file names at any depth",
+					},
+					"path": {
+						Type:        "string",
+						Description: "Directory to search in (defaults to current directory)",
+					},
+				},
+				Required: []string{"pattern"},
+			},
+		},
+	}
+}
+
+func (t *GlobTool) Definition() llm.Tool {
+	return GlobToolDefinition()
+}
+
+func (t *GlobTool) ReadOnly() bool { return true }
@@ -0,0 +1,63 @@
+package tools
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    []string
+	}{
+		{pattern: "*.go", want: []string{"main.go", "internal/a.go"}},
+		{pattern: "**/*.go", want: []string{"main.go", "internal/a.go"}},
+		{pattern: "internal/**/*.go", want: []string{"internal/a.go"}},
+		{pattern: "*.log", want: []string{"keep.log"}},
+		{pattern: "secret.txt", want: []string{"docs/secret.txt"}},
+		{pattern: "*.go", path: "internal", want: []string{"internal/a.go"}},
+		{pattern: "*.rs", want: nil},
+	}
+
+	ws := newTestWorkspace(t, ignoreFiles)
+	tool := NewGlobTool(ws)
+	for _, tt := range tests {
+		t.Run(tt.pattern+" in "+tt.path, func(t *testing.T) {
+			result, err := tool.Execute(context.Background(), map[string]any{"pattern": tt.pattern, "path": tt.path})
+			if err != nil || !result.Success {
+				t.Fatalf("glob failed: %v %s", err, result.Error)
+			}
+			if tt.want == nil {
+				if result.Output != "No files found" {
+					t.Errorf("output %q, want no files", result.Output)
+				}
+				return
+			}
+			assertLines(t, result.Output, tt.want)
+		})
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "a/b/c.go", true},
+		{"a/**", "a/b/c", true},
+		{"a/**/c", "a/c", true},
+		{"a/**/c", "a/b/x/c", true},
+		{"a/**/c", "a/b/x/d", false},
+		{"a/*/c", "a/b/x/c", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
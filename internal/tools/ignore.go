@@ -0,0 +1,225 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// skipDirs are directories never worth walking into when exploring a workspace
+var skipDirs = map[string]bool{
+	".git":         true,
+	".hg":          true,
+	".svn":         true,
+	"node_modules": true,
+	"vendor":       true,
+}
+
+// ignoreRule is a single pattern from a .gitignore file
+type ignoreRule struct {
+	dir     string // absolute directory of the .gitignore file
+	pattern string // slash-separated pattern relative to dir
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreMatcher decides which paths are ignored by .gitignore files
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+// newIgnoreMatcher creates a matcher for walking root
+// .gitignore files in the parent directories up to the repository root are loaded as well
+func newIgnoreMatcher(root string) *ignoreMatcher {
+	m := &ignoreMatcher{}
+
+	var parents []string
+	for dir := filepath.Dir(root); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			parents = append(parents, dir)
+			break
+		}
+		parents = append(parents, dir)
+		if filepath.Dir(dir) == dir {
+			// Not inside a repository, parent ignore files don't apply
+			parents = nil
+			break
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, ".git")); err == nil {
+		parents = nil
+	}
+
+	// Outer files first so that inner rules take precedence
+	for i := len(parents) - 1; i >= 0; i-- {
+		m.load(parents[i])
+	}
+	return m
+}
+
+// load adds the rules of dir/.gitignore if the file exists
+func (m *ignoreMatcher) load(dir string) {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{dir: dir}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, "\\")
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		// Patterns without a slash match at any depth, others are relative to the file's directory
+		if strings.Contains(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			line = "**/" + line
+		}
+		rule.pattern = line
+		m.rules = append(m.rules, rule)
+	}
+}
+
+// Match reports whether the absolute path is ignored
+// The last matching rule wins, so negated patterns can re-include paths
+func (m *ignoreMatcher) Match(absPath string, isDir bool) bool {
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel, ok := strings.CutPrefix(absPath, rule.dir+string(filepath.Separator))
+		if !ok {
+			continue
+		}
+		if matchGlob(rule.pattern, filepath.ToSlash(rel)) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// walkWorkspace walks the files under root, skipping version control and dependency
+// directories and anything ignored by .gitignore files
+// fn receives each regular file with its slash-separated path relative to root
+func walkWorkspace(ctx context.Context, root string, fn func(rel string, d fs.DirEntry) error) error {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	ignore := newIgnoreMatcher(root)
+
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip unreadable entries instead of aborting the whole walk
+			if d != nil && d.IsDir() && p != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if p != root && (skipDirs[d.Name()] || ignore.Match(p, true)) {
+				return filepath.SkipDir
+			}
+			ignore.load(p)
+			return nil
+		}
+		if !d.Type().IsRegular() || ignore.Match(p, false) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+		return fn(filepath.ToSlash(rel), d)
+	})
+}
+
+// matchGlob matches a slash-separated path against a glob pattern
+// "**" matches any number of path segments, other segments use path.Match syntax
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse repeated ** and try every possible number of segments
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// matchAnyGlob reports whether a path matches one of the patterns
+// Patterns without a slash are matched against the file name only
+func matchAnyGlob(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if !strings.Contains(p, "/") {
+			if ok, _ := path.Match(p, path.Base(rel)); ok {
+				return true
+			}
+			continue
+		}
+		if matchGlob(strings.TrimPrefix(p, "./"), rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPatterns splits a comma-separated list of glob patterns
+func splitPatterns(s string) []string {
+	var patterns []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
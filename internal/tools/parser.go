@@ -8,130 +8,332 @@ import (
 	"github.com/DanielNikkari/maahinen/internal/llm"
 )
 
-func ParseToolCallFromContent(content string) (*llm.ToolCall, bool) {
-	content = strings.TrimSpace(content)
+// Markers models use around tool calls written as text
+const (
+	toolCallTag      = "<tool_call>"
+	toolCallEndTag   = "</tool_call>"
+	pythonTag        = "<|python_tag|>"
+	mistralToolCalls = "[TOOL_CALLS]"
+	thinkTag         = "<think>"
+	thinkEndTag      = "</think>"
+)
 
-	// Try to extract name
-	namePattern := regexp.MustCompile(`"name"\s*:\s*"([^"]+)"`)
-	nameMatch := namePattern.FindStringSubmatch(content)
-	if nameMatch == nil {
-		return nil, false
+// ParseToolCalls returns the tool calls written in the text of a response, in order
+// Models without native tool calling write them in many formats: Hermes/Qwen <tool_call>
+// blocks (with JSON or <function=...> XML inside), fenced or bare JSON objects and arrays,
+// Llama <|python_tag|> and Mistral [TOOL_CALLS]. Calls to tools that aren't registered or
+// missing required arguments are left out, so JSON that only looks like a call isn't run
+func (r *Registry) ParseToolCalls(content string) []llm.ToolCall {
+	var calls []llm.ToolCall
+	for _, tc := range parseToolCalls(content) {
+		if r.acceptsCall(tc) {
+			calls = append(calls, tc)
+		}
 	}
-	name := nameMatch[1]
+	return calls
+}
+
+// acceptsCall reports whether a parsed call fits a registered tool's parameters
+func (r *Registry) acceptsCall(tc llm.ToolCall) bool {
+	name, _ := r.Resolve(tc.Function.Name)
+	t, ok := r.Get(name)
+	if !ok {
+		return false
+	}
+	params := t.Definition().Function.Parameters
+	for _, name := range params.Required {
+		if _, ok := tc.Function.Arguments[name]; !ok {
+			return false
+		}
+	}
+	if len(params.Properties) == 0 {
+		return true
+	}
+	// At least one argument must be one the tool knows, unless it takes none
+	for name := range tc.Function.Arguments {
+		if _, ok := params.Properties[name]; ok {
+			return true
+		}
+	}
+	return len(tc.Function.Arguments) == 0 && len(params.Required) == 0
+}
+
+// parseToolCalls finds everything that looks like a tool call, without checking the tools
+func parseToolCalls(content string) []llm.ToolCall {
+	var calls []llm.ToolCall
+	for i := 0; i < len(content); {
+		rest := content[i:]
+		switch {
+		case strings.HasPrefix(rest, thinkTag):
+			// Reasoning often drafts calls that were never meant to run
+			end := strings.Index(rest, thinkEndTag)
+			if end < 0 {
+				return calls
+			}
+			i += end + len(thinkEndTag)
+
+		case strings.HasPrefix(rest, toolCallTag):
+			inner, n := between(rest[len(toolCallTag):], toolCallEndTag)
+			calls = append(calls, parseTaggedCall(inner)...)
+			i += len(toolCallTag) + n
+
+		case strings.HasPrefix(rest, pythonTag):
+			inner, n := between(rest[len(pythonTag):], "<|eom_id|>", "<|eot_id|>")
+			calls = append(calls, parseToolCalls(inner)...)
+			i += len(pythonTag) + n
+
+		case strings.HasPrefix(rest, mistralToolCalls):
+			tc, n, ok := parseMistralCall(rest[len(mistralToolCalls):])
+			if ok {
+				calls = append(calls, tc)
+			}
+			i += len(mistralToolCalls) + n
+
+		case strings.HasPrefix(rest, "```"):
+			inner, n, ok := fencedBlock(rest)
+			if !ok {
+				i += 3
+				continue
+			}
+			calls = append(calls, parseToolCalls(inner)...)
+			i += n
+
+		case rest[0] == '{' || rest[0] == '[':
+			if !looksLikeJSON(rest) {
+				i++
+				continue
+			}
+			raw := extractJSON(rest)
+			if raw == "" {
+				i++
+				continue
+			}
+			found, ok := decodeCalls(raw)
+			if !ok {
+				i++
+				continue
+			}
+			calls = append(calls, found...)
+			i += len(raw)
 
-	// Try to find path argument
-	pathPattern := regexp.MustCompile(`"path"\s*:\s*"([^"]+)"`)
-	pathMatch := pathPattern.FindStringSubmatch(content)
+		default:
+			i++
+		}
+	}
+	return calls
+}
 
-	// Try to find command argument - (?s) makes . match newlines
-	cmdPattern := regexp.MustCompile(`(?s)"command"\s*:\s*"((?:[^"\\]|\\.)*)"`)
-	cmdMatch := cmdPattern.FindStringSubmatch(content)
+// between returns s up to the first of the end markers and how much of s it consumed,
+// including the marker. Without an end marker the rest of s is returned
+func between(s string, ends ...string) (string, int) {
+	cut := -1
+	marker := ""
+	for _, end := range ends {
+		if j := strings.Index(s, end); j >= 0 && (cut < 0 || j < cut) {
+			cut, marker = j, end
+		}
+	}
+	if cut < 0 {
+		return s, len(s)
+	}
+	return s[:cut], cut + len(marker)
+}
 
-	// Try to find content argument - (?s) makes . match newlines
-	contentPattern := regexp.MustCompile(`(?s)"content"\s*:\s*"((?:[^"\\]|\\.)*)"`)
-	contentMatch := contentPattern.FindStringSubmatch(content)
+// fencedBlock returns the contents of the ``` block s starts with and its total length
+func fencedBlock(s string) (string, int, bool) {
+	nl := strings.IndexByte(s, '\n')
+	if nl < 0 {
+		return "", 0, false
+	}
+	end := strings.Index(s[nl:], "```")
+	if end < 0 {
+		// An unclosed fence at the end of a response
+		return s[nl+1:], len(s), true
+	}
+	return s[nl+1 : nl+end], nl + end + 3, true
+}
 
-	// Try old_string and new_string for edit tool
-	oldStrPattern := regexp.MustCompile(`(?s)"old_string"\s*:\s*"((?:[^"\\]|\\.)*)"`)
-	oldStrMatch := oldStrPattern.FindStringSubmatch(content)
+// looksLikeJSON cheaply checks that s starts a JSON object or an array of objects,
+// so prose with braces and markdown links aren't scanned
+func looksLikeJSON(s string) bool {
+	rest := strings.TrimLeft(s[1:], " \t\r\n")
+	if rest == "" {
+		return false
+	}
+	if s[0] == '{' {
+		return rest[0] == '"' || rest[0] == '}'
+	}
+	return rest[0] == '{'
+}
 
-	newStrPattern := regexp.MustCompile(`(?s)"new_string"\s*:\s*"((?:[^"\\]|\\.)*)"`)
-	newStrMatch := newStrPattern.FindStringSubmatch(content)
+// parseTaggedCall parses the inside of a <tool_call> block
+func parseTaggedCall(inner string) []llm.ToolCall {
+	if strings.Contains(inner, "<function=") {
+		return parseXMLCalls(inner)
+	}
+	return parseToolCalls(inner)
+}
 
-	args := make(map[string]any)
+var (
+	xmlFunctionPattern  = regexp.MustCompile(`(?s)<function=([^>\s]+)>(.*?)(?:</function>|$)`)
+	xmlParameterPattern = regexp.MustCompile(`(?s)<parameter=([^>\s]+)>(.*?)(?:</parameter>|$)`)
+)
 
-	if pathMatch != nil {
-		args["path"] = pathMatch[1]
+// parseXMLCalls parses the XML call format of Qwen3-Coder:
+// <function=name><parameter=key>value</parameter></function>
+func parseXMLCalls(s string) []llm.ToolCall {
+	var calls []llm.ToolCall
+	for _, fn := range xmlFunctionPattern.FindAllStringSubmatch(s, -1) {
+		args := make(map[string]any)
+		for _, param := range xmlParameterPattern.FindAllStringSubmatch(fn[2], -1) {
+			value := strings.TrimPrefix(param[2], "\n")
+			value = strings.TrimSuffix(value, "\n")
+			args[param[1]] = value
+		}
+		calls = append(calls, newToolCall(fn[1], args))
 	}
-	if cmdMatch != nil {
-		args["command"] = unescapeJSON(cmdMatch[1])
+	return calls
+}
+
+var mistralNamePattern = regexp.MustCompile(`^\s*([A-Za-z0-9_.-]+)(?:\[CALL_ID\][A-Za-z0-9]*)?\[ARGS\]`)
+
+// parseMistralCall parses what follows [TOOL_CALLS]: either a JSON array of calls or,
+// in newer Mistral templates, name[ARGS]{...}. Returns how much of s was consumed
+func parseMistralCall(s string) (llm.ToolCall, int, bool) {
+	m := mistralNamePattern.FindStringSubmatch(s)
+	if m == nil {
+		// A JSON array, picked up by the JSON scan that follows
+		return llm.ToolCall{}, 0, false
 	}
-	if contentMatch != nil {
-		args["content"] = unescapeJSON(contentMatch[1])
+	n := len(m[0])
+	raw := extractJSON(strings.TrimLeft(s[n:], " \t\r\n"))
+	if raw == "" {
+		return llm.ToolCall{}, n, false
 	}
-	if oldStrMatch != nil {
-		args["old_string"] = unescapeJSON(oldStrMatch[1])
+	n += strings.Index(s[n:], raw) + len(raw)
+
+	var args map[string]any
+	if err := unmarshalLenient(raw, &args); err != nil {
+		return llm.ToolCall{}, n, false
 	}
-	if newStrMatch != nil {
-		args["new_string"] = unescapeJSON(newStrMatch[1])
+	return newToolCall(m[1], args), n, true
+}
+
+// decodeCalls decodes a JSON object or array holding one or more calls
+func decodeCalls(raw string) ([]llm.ToolCall, bool) {
+	var v any
+	if err := unmarshalLenient(raw, &v); err != nil {
+		return nil, false
 	}
+	calls := callsFromValue(v)
+	return calls, len(calls) > 0
+}
+
+// callsFromValue reads calls from decoded JSON in the shapes models use:
+// {"name": ..., "arguments"|"parameters"|"args"|"input": {...}}, the OpenAI
+// {"function": {"name": ..., "arguments": "..."}} and {"tool_calls": [...]}, and arrays of those
+func callsFromValue(v any) []llm.ToolCall {
+	switch v := v.(type) {
+	case []any:
+		var calls []llm.ToolCall
+		for _, item := range v {
+			calls = append(calls, callsFromValue(item)...)
+		}
+		return calls
+	case map[string]any:
+		if list, ok := v["tool_calls"]; ok {
+			return callsFromValue(list)
+		}
+		if fn, ok := v["function"].(map[string]any); ok {
+			return callsFromValue(fn)
+		}
 
-	// Try standard JSON parsing as fallback
-	if len(args) == 0 {
-		jsonContent := extractJSON(content)
-		if jsonContent != "" {
-			var tc struct {
-				Name       string         `json:"name"`
-				Arguments  map[string]any `json:"arguments"`
-				Parameters map[string]any `json:"parameters"`
+		name := firstString(v, "name", "tool", "tool_name", "function")
+		if name == "" {
+			return nil
+		}
+		args := map[string]any{}
+		for _, key := range []string{"arguments", "parameters", "args", "input"} {
+			if a, ok := v[key].(map[string]any); ok {
+				args = a
+				break
 			}
-			if err := json.Unmarshal([]byte(jsonContent), &tc); err == nil {
-				if tc.Arguments != nil {
-					args = tc.Arguments
-				} else if tc.Parameters != nil {
-					args = tc.Parameters
+			if a, ok := v[key].(string); ok {
+				// OpenAI sends arguments as a JSON string
+				if err := unmarshalLenient(a, &args); err != nil {
+					return nil
 				}
+				break
 			}
 		}
+		return []llm.ToolCall{newToolCall(name, args)}
 	}
+	return nil
+}
 
-	if name == "" || len(args) == 0 {
-		return nil, false
+func firstString(m map[string]any, keys ...string) string {
+	for _, key := range keys {
+		if s, ok := m[key].(string); ok && s != "" {
+			return s
+		}
 	}
+	return ""
+}
 
-	return &llm.ToolCall{
+func newToolCall(name string, args map[string]any) llm.ToolCall {
+	return llm.ToolCall{
 		Function: llm.ToolFunction{
-			Name:      name,
+			Name:      strings.TrimSpace(name),
 			Arguments: args,
 		},
-	}, true
+	}
 }
 
-func extractJSON(content string) string {
-	content = strings.TrimPrefix(content, "```json")
-	content = strings.TrimPrefix(content, "```")
-	content = strings.TrimSuffix(content, "```")
-	content = strings.TrimSpace(content)
-
-	content = fixBacktickStrings(content)
-
-	start := strings.Index(content, "{")
-	if start == -1 {
-		return ""
+// unmarshalLenient decodes JSON, repairing the mistakes models commonly make if needed
+func unmarshalLenient(raw string, v any) error {
+	err := json.Unmarshal([]byte(raw), v)
+	if err == nil {
+		return nil
 	}
+	if fixed := repairJSON(raw); fixed != raw {
+		if json.Unmarshal([]byte(fixed), v) == nil {
+			return nil
+		}
+	}
+	return err
+}
 
+// extractJSON returns the balanced JSON object or array s starts with, or "" if it isn't closed
+// Backtick-quoted strings are skipped over like JSON strings
+func extractJSON(s string) string {
 	depth := 0
-	inString := false
+	var quote byte
 	escaped := false
 
-	for i := start; i < len(content); i++ {
-		c := content[i]
-
-		if escaped {
-			escaped = false
-			continue
-		}
-
-		if c == '\\' && inString {
-			escaped = true
-			continue
-		}
-
-		if c == '"' {
-			inString = !inString
-			continue
-		}
-
-		if inString {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		if quote != 0 {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\' && quote == '"':
+				escaped = true
+			case c == quote:
+				quote = 0
+			}
 			continue
 		}
 
-		if c == '{' {
+		switch c {
+		case '"', '`':
+			quote = c
+		case '{', '[':
 			depth++
-		} else if c == '}' {
+		case '}', ']':
 			depth--
 			if depth == 0 {
-				return content[start : i+1]
+				return s[:i+1]
 			}
 		}
 	}
@@ -139,37 +341,59 @@ func extractJSON(content string) string {
 	return ""
 }
 
-func fixBacktickStrings(content string) string {
-	result := strings.Builder{}
-	i := 0
+// repairJSON fixes backtick-quoted strings, raw newlines and tabs inside strings and
+// trailing commas, which models often produce when writing code into JSON by hand
+func repairJSON(s string) string {
+	var sb strings.Builder
+	inString := false
+	escaped := false
 
-	for i < len(content) {
-		// Check if we're at a backtick that's part of a JSON value
-		if content[i] == '`' {
-			// Find the closing backtick
-			end := strings.Index(content[i+1:], "`")
-			if end == -1 {
-				result.WriteByte(content[i])
-				i++
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			case c == '\n':
+				sb.WriteString(`\n`)
+				continue
+			case c == '\r':
+				sb.WriteString(`\r`)
+				continue
+			case c == '\t':
+				sb.WriteString(`\t`)
 				continue
 			}
-
-			// Extract the content between backticks
-			inner := content[i+1 : i+1+end]
-
-			// Convert to JSON string: escape quotes and newlines
-			jsonStr := escapeForJSON(inner)
-			result.WriteString(`"` + jsonStr + `"`)
-
-			i = i + 1 + end + 1 // Skip past closing backtick
+			sb.WriteByte(c)
 			continue
 		}
 
-		result.WriteByte(content[i])
-		i++
+		switch c {
+		case '"':
+			inString = true
+		case '`':
+			end := strings.IndexByte(s[i+1:], '`')
+			if end >= 0 {
+				sb.WriteString(`"` + escapeForJSON(s[i+1:i+1+end]) + `"`)
+				i += end + 1
+				continue
+			}
+		case ',':
+			// Drop commas directly before a closing bracket
+			rest := strings.TrimLeft(s[i+1:], " \t\r\n")
+			if rest != "" && (rest[0] == '}' || rest[0] == ']') {
+				continue
+			}
+		}
+		sb.WriteByte(c)
 	}
 
-	return result.String()
+	return sb.String()
 }
 
 func escapeForJSON(s string) string {
@@ -180,11 +404,3 @@ func escapeForJSON(s string) string {
 	s = strings.ReplaceAll(s, "\t", `\t`)
 	return s
 }
-
-func unescapeJSON(s string) string {
-	s = strings.ReplaceAll(s, `\n`, "\n")
-	s = strings.ReplaceAll(s, `\t`, "\t")
-	s = strings.ReplaceAll(s, `\"`, `"`)
-	s = strings.ReplaceAll(s, `\\`, `\`)
-	return s
-}
@@ -0,0 +1,210 @@
+package tools
+
+import (
+	"reflect"
+	"testing"
+)
+
+type wantCall struct {
+	name string
+	args map[string]any
+}
+
+func newTestRegistry(t *testing.T) *Registry {
+	t.Helper()
+	ws, err := NewWorkspace(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	procs := NewProcessManager(ws.Root())
+	r := NewRegistry()
+	r.Register(NewBashTool(ws.Root()))
+	r.Register(NewReadTool(ws))
+	r.Register(NewWriteTool(ws))
+	r.Register(NewListTool(ws))
+	r.Register(NewProcessListTool(procs))
+	return r
+}
+
+func TestParseToolCalls(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []wantCall
+	}{
+		{
+			name:    "hermes json",
+			content: "I'll read the file.\n<tool_call>\n{\"name\": \"read\", \"arguments\": {\"path\": \"main.go\"}}\n</tool_call>",
+			want:    []wantCall{{"read", map[string]any{"path": "main.go"}}},
+		},
+		{
+			name: "hermes several blocks",
+			content: "<tool_call>\n{\"name\": \"read\", \"arguments\": {\"path\": \"a.go\"}}\n</tool_call>\n" +
+				"<tool_call>\n{\"name\": \"read\", \"arguments\": {\"path\": \"b.go\"}}\n</tool_call>",
+			want: []wantCall{
+				{"read", map[string]any{"path": "a.go"}},
+				{"read", map[string]any{"path": "b.go"}},
+			},
+		},
+		{
+			name: "qwen3 xml",
+			content: "<tool_call>\n<function=write>\n<parameter=path>\nhello.txt\n</parameter>\n" +
+				"<parameter=content>\nline one\nline two\n</parameter>\n</function>\n</tool_call>",
+			want: []wantCall{{"write", map[string]any{"path": "hello.txt", "content": "line one\nline two"}}},
+		},
+		{
+			name:    "fenced json",
+			content: "Let me look around:\n```json\n{\"name\": \"bash\", \"arguments\": {\"command\": \"ls -la\"}}\n```\n",
+			want:    []wantCall{{"bash", map[string]any{"command": "ls -la"}}},
+		},
+		{
+			name:    "fenced openai shape with string arguments",
+			content: "```\n{\"type\": \"function\", \"function\": {\"name\": \"read\", \"arguments\": \"{\\\"path\\\": \\\"a.go\\\"}\"}}\n```",
+			want:    []wantCall{{"read", map[string]any{"path": "a.go"}}},
+		},
+		{
+			name:    "bare object",
+			content: "{\"name\": \"list\", \"parameters\": {\"path\": \".\"}}",
+			want:    []wantCall{{"list", map[string]any{"path": "."}}},
+		},
+		{
+			name:    "bare array",
+			content: "[{\"name\": \"read\", \"arguments\": {\"path\": \"a.go\"}}, {\"name\": \"read\", \"arguments\": {\"path\": \"b.go\"}}]",
+			want: []wantCall{
+				{"read", map[string]any{"path": "a.go"}},
+				{"read", map[string]any{"path": "b.go"}},
+			},
+		},
+		{
+			name:    "tool_calls wrapper",
+			content: "{\"tool_calls\": [{\"function\": {\"name\": \"bash\", \"arguments\": {\"command\": \"pwd\"}}}]}",
+			want:    []wantCall{{"bash", map[string]any{"command": "pwd"}}},
+		},
+		{
+			name:    "llama python_tag",
+			content: "<|python_tag|>{\"name\": \"bash\", \"parameters\": {\"command\": \"go test ./...\"}}<|eom_id|>",
+			want:    []wantCall{{"bash", map[string]any{"command": "go test ./..."}}},
+		},
+		{
+			name:    "mistral array",
+			content: "[TOOL_CALLS] [{\"name\": \"read\", \"arguments\": {\"path\": \"x.go\"}}]",
+			want:    []wantCall{{"read", map[string]any{"path": "x.go"}}},
+		},
+		{
+			name:    "mistral name args",
+			content: "[TOOL_CALLS]read[ARGS]{\"path\": \"x.go\"}",
+			want:    []wantCall{{"read", map[string]any{"path": "x.go"}}},
+		},
+		{
+			name: "call drafted while thinking is ignored",
+			content: "<think>Maybe {\"name\": \"bash\", \"arguments\": {\"command\": \"rm -rf /\"}} but no.</think>\n" +
+				"<tool_call>{\"name\": \"read\", \"arguments\": {\"path\": \"a.go\"}}</tool_call>",
+			want: []wantCall{{"read", map[string]any{"path": "a.go"}}},
+		},
+		{
+			name:    "unclosed thinking",
+			content: "<think>I could call {\"name\": \"bash\", \"arguments\": {\"command\": \"ls\"}}",
+		},
+		{
+			name:    "prose with braces",
+			content: "Use a map like {key: value} or see [the docs](https://example.com) and [1, 2].",
+		},
+		{
+			name:    "backtick quoted content",
+			content: "{\"name\": \"write\", \"arguments\": {\"path\": \"a.go\", \"content\": `package main\n\nfunc main() {}\n`}}",
+			want:    []wantCall{{"write", map[string]any{"path": "a.go", "content": "package main\n\nfunc main() {}\n"}}},
+		},
+		{
+			name:    "raw newline and trailing comma",
+			content: "<tool_call>{\"name\": \"write\", \"arguments\": {\"path\": \"a.txt\", \"content\": \"one\ntwo\",},}</tool_call>",
+			want:    []wantCall{{"write", map[string]any{"path": "a.txt", "content": "one\ntwo"}}},
+		},
+	}
+
+	r := newTestRegistry(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertCalls(t, r, tt.content, tt.want)
+		})
+	}
+}
+
+func TestParseToolCallsRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []wantCall
+	}{
+		{
+			name:    "unknown tool",
+			content: "{\"name\": \"launch_rockets\", \"arguments\": {\"count\": 3}}",
+		},
+		{
+			name:    "missing required argument",
+			content: "<tool_call>{\"name\": \"read\", \"arguments\": {}}</tool_call>",
+		},
+		{
+			name:    "no known argument",
+			content: "{\"name\": \"list\", \"arguments\": {\"folder\": \"src\"}}",
+		},
+		{
+			name:    "example json that isn't a call",
+			content: "The response looks like:\n{\"name\": \"Alice\", \"age\": 30}",
+		},
+		{
+			name:    "alias is accepted",
+			content: "{\"name\": \"read_file\", \"arguments\": {\"path\": \"a.go\"}}",
+			want:    []wantCall{{"read_file", map[string]any{"path": "a.go"}}},
+		},
+		{
+			name:    "tool without arguments",
+			content: "<tool_call>{\"name\": \"process_list\", \"arguments\": {}}</tool_call>",
+			want:    []wantCall{{"process_list", map[string]any{}}},
+		},
+	}
+
+	r := newTestRegistry(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertCalls(t, r, tt.content, tt.want)
+		})
+	}
+}
+
+func assertCalls(t *testing.T, r *Registry, content string, want []wantCall) {
+	t.Helper()
+	calls := r.ParseToolCalls(content)
+	if len(calls) != len(want) {
+		t.Fatalf("got %d calls %+v, want %d", len(calls), calls, len(want))
+	}
+	for i, w := range want {
+		got := calls[i].Function
+		if got.Name != w.name {
+			t.Errorf("call %d: name %q, want %q", i, got.Name, w.name)
+		}
+		if !reflect.DeepEqual(got.Arguments, w.args) {
+			t.Errorf("call %d: arguments %#v, want %#v", i, got.Arguments, w.args)
+		}
+	}
+}
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"valid json is unchanged", `{"a": "b", "c": [1, 2]}`, `{"a": "b", "c": [1, 2]}`},
+		{"backtick string", "{\"a\": `say \"hi\"`}", `{"a": "say \"hi\""}`},
+		{"raw newline and tab", "{\"a\": \"one\n\ttwo\"}", `{"a": "one\n\ttwo"}`},
+		{"trailing commas", `{"a": [1, 2,], }`, `{"a": [1, 2] }`},
+		{"comma inside string is kept", `{"a": "x,]"}`, `{"a": "x,]"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := repairJSON(tt.in); got != tt.want {
+				t.Errorf("repairJSON(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
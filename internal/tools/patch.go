@@ -0,0 +1,576 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/DanielNikkari/maahinen/internal/llm"
+)
+
+// Most leading and trailing context lines a hunk may lose when its context doesn't match
+const patchMaxFuzz = 2
+
+type PatchTool struct {
+	ws *Workspace
+}
+
+func NewPatchTool(ws *Workspace) *PatchTool {
+	return &PatchTool{ws: ws}
+}
+
+func (t *PatchTool) Name() string        { return "apply_patch" }
+func (t *PatchTool) Description() string { return "Apply a unified diff to one or more files" }
+func (t *PatchTool) Aliases() []string {
+	return []string{"patch", "apply_diff", "diff", "apply_unified_diff"}
+}
+
+func (t *PatchTool) Execute(ctx context.Context, args map[string]any) (Result, error) {
+	patch, ok := args["patch"].(string)
+	if !ok || strings.TrimSpace(patch) == "" {
+		return Result{Success: false, Error: "missing 'patch' argument"}, nil
+	}
+
+	files, err := parsePatch(patch)
+	if err != nil {
+		return Result{Success: false, Error: err.Error()}, nil
+	}
+
+	// Apply every file in memory first so nothing is written unless the whole patch applies
+	// Each file patch starts from the file on disk, so a file may only be changed by one
+	var changes []*fileChange
+	var failures []string
+	touched := map[string]bool{}
+	for _, fp := range files {
+		prepared, errs := t.prepare(fp)
+		if len(errs) > 0 {
+			failures = append(failures, errs...)
+			continue
+		}
+		for _, c := range prepared {
+			if touched[c.path] {
+				name := c.path
+				if rel, err := filepath.Rel(t.ws.Root(), c.path); err == nil {
+					name = rel
+				}
+				failures = append(failures, fmt.Sprintf("%s: changed by more than one file patch, put all of its hunks under one --- and +++ header", name))
+			}
+			touched[c.path] = true
+		}
+		changes = append(changes, prepared...)
+	}
+	if len(failures) > 0 {
+		return Result{
+			Success: false,
+			Error:   "patch not applied, no files were changed:\n" + strings.Join(failures, "\n"),
+		}, nil
+	}
+
+	if err := writeChanges(changes); err != nil {
+		return Result{Success: false, Error: err.Error()}, nil
+	}
+
+	var lines []string
+	lines = append(lines, "Patch applied:")
+	for _, c := range changes {
+		if c.summary == "" {
+			continue
+		}
+		lines = append(lines, "  "+c.summary)
+		for _, note := range c.notes {
+			lines = append(lines, "    "+note)
+		}
+	}
+	return Result{Success: true, Output: strings.Join(lines, "\n")}, nil
+}
+
+// filePatch is the part of a patch that changes one file
+type filePatch struct {
+	oldPath string // empty when the file is created
+	newPath string // empty when the file is deleted
+	hunks   []*hunk
+}
+
+// hunk is a single @@ section of a file patch
+type hunk struct {
+	header   string
+	oldStart int
+	oldCount int
+	// oldLeft and newLeft count the body lines still expected by the header, they are
+	// only known when counted is set
+	oldLeft int
+	newLeft int
+	counted bool
+	lines   []hunkLine
+	// noEOF is set when the new file must not end with a newline, oldNoEOF when the old
+	// file didn't end with one
+	noEOF    bool
+	oldNoEOF bool
+}
+
+// open reports whether the header's line counts say more body lines follow
+func (h *hunk) open() bool {
+	return h.counted && (h.oldLeft > 0 || h.newLeft > 0)
+}
+
+// add appends a body line and counts it against the header's line counts
+func (h *hunk) add(l hunkLine) {
+	h.lines = append(h.lines, l)
+	if l.op != '+' {
+		h.oldLeft--
+	}
+	if l.op != '-' {
+		h.newLeft--
+	}
+}
+
+type hunkLine struct {
+	op   byte // ' ', '-' or '+'
+	text string
+}
+
+// fileChange is a file patch applied in memory
+type fileChange struct {
+	path     string
+	content  string
+	original []byte // nil when the file did not exist
+	delete   bool
+	summary  string // empty for the removal half of a rename
+	notes    []string
+}
+
+// parsePatch splits a unified diff into per-file patches
+// While a hunk's header counts say more lines follow, --- and +++ lines belong to its body
+func parsePatch(patch string) ([]*filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n")
+
+	var files []*filePatch
+	var cur *filePatch
+	var h *hunk
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		switch {
+		case (h == nil || !h.open()) && strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			cur = &filePatch{
+				oldPath: patchPath(line[4:]),
+				newPath: patchPath(lines[i+1][4:]),
+			}
+			if cur.oldPath == "" && cur.newPath == "" {
+				return nil, fmt.Errorf("invalid file header: %s", line)
+			}
+			files = append(files, cur)
+			h = nil
+			i++
+		case strings.HasPrefix(line, "@@"):
+			if cur == nil {
+				return nil, fmt.Errorf("hunk before any file header (expected --- and +++ lines): %s", line)
+			}
+			h = &hunk{header: line}
+			h.oldStart, h.oldCount, h.newLeft, h.counted = parseHunkHeader(line)
+			h.oldLeft = h.oldCount
+			cur.hunks = append(cur.hunks, h)
+		case h == nil:
+			// diff --git, index and other metadata lines
+			continue
+		case strings.HasPrefix(line, `\`):
+			// "\ No newline at end of file" applies to the line before it
+			if len(h.lines) == 0 {
+				continue
+			}
+			switch h.lines[len(h.lines)-1].op {
+			case '-':
+				h.oldNoEOF = true
+			case '+':
+				h.noEOF = true
+			default:
+				h.noEOF = true
+				h.oldNoEOF = true
+			}
+		case line == "":
+			// Editors and models often strip the single space of empty context lines
+			if i < len(lines)-1 {
+				h.add(hunkLine{op: ' '})
+			}
+		case line[0] == ' ' || line[0] == '-' || line[0] == '+':
+			h.add(hunkLine{op: line[0], text: line[1:]})
+		default:
+			return nil, fmt.Errorf("unexpected line in hunk %s: %q (lines must start with ' ', '-' or '+')", h.header, line)
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no file headers found, the patch must be a unified diff with --- and +++ lines")
+	}
+	for _, fp := range files {
+		if len(fp.hunks) == 0 && fp.newPath != "" {
+			return nil, fmt.Errorf("no hunks for %s", fp.newPath)
+		}
+	}
+	return files, nil
+}
+
+// patchPath extracts the file path from a --- or +++ header
+// Returns "" for /dev/null
+func patchPath(s string) string {
+	// Drop a trailing timestamp
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if s == "/dev/null" {
+		return ""
+	}
+	return s
+}
+
+// parseHunkHeader parses "@@ -l,s +l,s @@", missing numbers are returned as 0
+// ok reports whether both ranges could be read
+func parseHunkHeader(header string) (oldStart, oldCount, newCount int, ok bool) {
+	fields := strings.Fields(header)
+	if len(fields) < 2 || !strings.HasPrefix(fields[1], "-") {
+		return 0, 0, 0, false
+	}
+	oldStart, oldCount, ok = parseRange(fields[1][1:])
+	if !ok || len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+		return oldStart, oldCount, 0, false
+	}
+	_, newCount, ok = parseRange(fields[2][1:])
+	return oldStart, oldCount, newCount, ok
+}
+
+// parseRange parses the "l,s" of a hunk header, s defaults to 1
+func parseRange(r string) (start, count int, ok bool) {
+	parts := strings.SplitN(r, ",", 2)
+	start, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	count = 1
+	if len(parts) == 2 {
+		if count, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, 0, false
+		}
+	}
+	return start, count, true
+}
+
+// resolve returns the path of a patch file on disk
+func (t *PatchTool) resolve(p string) (string, error) {
+	return t.ws.Resolve(t.display(p))
+}
+
+// display returns the path of a patch file as written in the patch
+// Git style a/ and b/ prefixes are removed unless the prefixed path exists
+func (t *PatchTool) display(p string) string {
+	if strings.HasPrefix(p, "a/") || strings.HasPrefix(p, "b/") {
+		full := p
+		if !filepath.IsAbs(full) && t.ws.Root() != "" {
+			full = filepath.Join(t.ws.Root(), full)
+		}
+		if _, err := os.Stat(full); err != nil {
+			return p[2:]
+		}
+	}
+	return p
+}
+
+// prepare applies a file patch in memory
+func (t *PatchTool) prepare(fp *filePatch) ([]*fileChange, []string) {
+	switch {
+	case fp.oldPath == "":
+		path, err := t.resolve(fp.newPath)
+		if err != nil {
+			return nil, []string{err.Error()}
+		}
+		if _, err := os.Stat(path); err == nil {
+			return nil, []string{fmt.Sprintf("%s: cannot create, file already exists", t.display(fp.newPath))}
+		}
+		var added []string
+		noEOF := false
+		for _, h := range fp.hunks {
+			for _, l := range h.lines {
+				if l.op != '-' {
+					added = append(added, l.text)
+				}
+			}
+			noEOF = h.noEOF
+		}
+		content := strings.Join(added, "\n")
+		if !noEOF && len(added) > 0 {
+			content += "\n"
+		}
+		return []*fileChange{{path: path, content: content, summary: "A " + t.display(fp.newPath)}}, nil
+
+	case fp.newPath == "":
+		path, err := t.resolve(fp.oldPath)
+		if err != nil {
+			return nil, []string{err.Error()}
+		}
+		original, err := os.ReadFile(path)
+		if err != nil {
+			return nil, []string{"cannot delete: " + err.Error()}
+		}
+		return []*fileChange{{path: path, original: original, delete: true, summary: "D " + t.display(fp.oldPath)}}, nil
+	}
+
+	path, err := t.resolve(fp.oldPath)
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+
+	content := string(original)
+	crlf := strings.Contains(content, "\r\n")
+	if crlf {
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+	}
+	endsWithNewline := strings.HasSuffix(content, "\n")
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+
+	var errs, notes []string
+	offset, minPos := 0, 0
+	for i, h := range fp.hunks {
+		pos, used, note, ok := findHunk(lines, h, h.oldStart-1+offset, minPos)
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s: hunk %d (%s) failed: %s", t.display(fp.oldPath), i+1, h.header, describeHunk(h)))
+			continue
+		}
+		if note != "" {
+			notes = append(notes, fmt.Sprintf("hunk %d %s", i+1, note))
+		}
+
+		// Context lines keep the file's text in case they only matched ignoring whitespace
+		var oldLines, newLines []string
+		for _, l := range used {
+			switch l.op {
+			case ' ':
+				text := lines[pos+len(oldLines)]
+				oldLines = append(oldLines, text)
+				newLines = append(newLines, text)
+			case '-':
+				oldLines = append(oldLines, lines[pos+len(oldLines)])
+			case '+':
+				newLines = append(newLines, l.text)
+			}
+		}
+
+		updated := make([]string, 0, len(lines)-len(oldLines)+len(newLines))
+		updated = append(updated, lines[:pos]...)
+		updated = append(updated, newLines...)
+		updated = append(updated, lines[pos+len(oldLines):]...)
+		lines = updated
+
+		offset += len(newLines) - len(oldLines)
+		minPos = pos + len(newLines)
+		if h.noEOF {
+			endsWithNewline = false
+		} else if h.oldNoEOF {
+			// Only the old side lacked the newline, so the patch adds it
+			endsWithNewline = true
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	newContent := strings.Join(lines, "\n")
+	if endsWithNewline && len(lines) > 0 {
+		newContent += "\n"
+	}
+	if crlf {
+		newContent = strings.ReplaceAll(newContent, "\n", "\r\n")
+	}
+
+	newPath, err := t.resolve(fp.newPath)
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+	if newPath != path {
+		// A rename writes the new path and removes the old file
+		if _, err := os.Stat(newPath); err == nil {
+			return nil, []string{fmt.Sprintf("%s: cannot rename onto an existing file", t.display(fp.newPath))}
+		}
+		return []*fileChange{
+			{path: newPath, content: newContent, summary: fmt.Sprintf("R %s -> %s", t.display(fp.oldPath), t.display(fp.newPath)), notes: notes},
+			{path: path, original: original, delete: true},
+		}, nil
+	}
+	return []*fileChange{{path: path, content: newContent, original: original, summary: "M " + t.display(fp.oldPath), notes: notes}}, nil
+}
+
+// findHunk locates the lines a hunk replaces, searching outward from the hinted position
+// If the context doesn't match exactly, whitespace differences are ignored and then up to
+// patchMaxFuzz context lines are dropped from either end of the hunk
+// Returns the position, the hunk lines actually applied and a note describing any fuzz
+func findHunk(lines []string, h *hunk, hint, minPos int) (int, []hunkLine, string, bool) {
+	for fuzz := 0; fuzz <= patchMaxFuzz; fuzz++ {
+		used := trimContext(h.lines, fuzz)
+		if fuzz > 0 && len(used) == len(h.lines) {
+			// Nothing left to trim
+			break
+		}
+
+		var old []string
+		for _, l := range used {
+			if l.op != '+' {
+				old = append(old, l.text)
+			}
+		}
+
+		if len(old) == 0 {
+			// Pure insertion, the header tells where. "-l,0" inserts after line l
+			pos := hint
+			if h.oldCount == 0 {
+				pos++
+			}
+			return max(min(pos, len(lines)), minPos), used, "", true
+		}
+
+		for _, normalize := range []bool{false, true} {
+			if pos, ok := searchLines(lines, old, hint, minPos, normalize); ok {
+				var notes []string
+				if normalize {
+					notes = append(notes, "matched ignoring whitespace")
+				}
+				if fuzz > 0 {
+					notes = append(notes, fmt.Sprintf("matched with %d context line(s) ignored", fuzz))
+				}
+				if pos != hint && h.oldStart > 0 {
+					notes = append(notes, fmt.Sprintf("applied at line %d instead of %d", pos+1, hint+1))
+				}
+				return pos, used, strings.Join(notes, ", "), true
+			}
+		}
+	}
+	return 0, nil, "", false
+}
+
+// trimContext drops up to n context lines from the start and the end of a hunk
+func trimContext(lines []hunkLine, n int) []hunkLine {
+	start, end := 0, len(lines)
+	for i := 0; i < n && start < end && lines[start].op == ' '; i++ {
+		start++
+	}
+	for i := 0; i < n && end > start && lines[end-1].op == ' '; i++ {
+		end--
+	}
+	return lines[start:end]
+}
+
+// searchLines finds old in lines at or after minPos, preferring positions close to hint
+func searchLines(lines, old []string, hint, minPos int, normalize bool) (int, bool) {
+	last := len(lines) - len(old)
+	if last < minPos {
+		return 0, false
+	}
+	hint = max(min(hint, last), minPos)
+
+	for d := 0; hint-d >= minPos || hint+d <= last; d++ {
+		for _, pos := range []int{hint - d, hint + d} {
+			if pos < minPos || pos > last {
+				continue
+			}
+			if linesEqual(lines[pos:pos+len(old)], old, normalize) {
+				return pos, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func linesEqual(a, b []string, normalize bool) bool {
+	for i := range b {
+		if normalize {
+			if strings.Join(strings.Fields(a[i]), " ") != strings.Join(strings.Fields(b[i]), " ") {
+				return false
+			}
+		} else if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// describeHunk explains a hunk failure with the first lines it expected to find
+func describeHunk(h *hunk) string {
+	var expected []string
+	for _, l := range h.lines {
+		if l.op != '+' {
+			expected = append(expected, "    "+l.text)
+		}
+		if len(expected) == 5 {
+			expected = append(expected, "    ...")
+			break
+		}
+	}
+	if len(expected) == 0 {
+		return "nothing to match"
+	}
+	return "context not found in file, expected:\n" + strings.Join(expected, "\n")
+}
+
+// writeChanges writes all changes, restoring the written files if one of them fails
+func writeChanges(changes []*fileChange) error {
+	for i, c := range changes {
+		var err error
+		if c.delete {
+			err = os.Remove(c.path)
+		} else {
+			if err = os.MkdirAll(filepath.Dir(c.path), 0755); err == nil {
+				err = os.WriteFile(c.path, []byte(c.content), 0644)
+			}
+		}
+		if err != nil {
+			rollback(changes[:i])
+			return fmt.Errorf("failed to write %s, no files were changed: %v", c.path, err)
+		}
+	}
+	return nil
+}
+
+// rollback restores files changed by writeChanges
+func rollback(changes []*fileChange) {
+	for _, c := range changes {
+		if c.original == nil {
+			os.Remove(c.path)
+		} else {
+			os.WriteFile(c.path, c.original, 0644)
+		}
+	}
+}
+
+func PatchToolDefinition() llm.Tool {
+	return llm.Tool{
+		Type: "function",
+		Function: llm.ToolDefinition{
+			Name: "apply_patch",
+			Description: "Apply a unified diff to one or more files. Use --- /dev/null to create a file and +++ /dev/null to delete one. " +
+				"Hunks are matched near their line numbers and tolerate small whitespace differences. " +
+				"The patch is applied completely or not at all.",
+			Parameters: llm.Parameters{
+				Type: "object",
+				Properties: map[string]llm.Property{
+					"patch": {
+						Type:        "string",
+						Description: "Unified diff with --- and +++ file headers and @@ hunks",
+					},
+				},
+				Required: []string{"patch"},
+			},
+		},
+	}
+}
+
+func (t *PatchTool) Definition() llm.Tool {
+	return PatchToolDefinition()
+}
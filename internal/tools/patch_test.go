@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		patch string
+		want  map[string]string
+		err   string
+	}{
+		{
+			name:  "modify",
+			files: map[string]string{"a.txt": "one\ntwo\nthree\n"},
+			patch: "--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n one\n-two\n+TWO\n three\n",
+			want:  map[string]string{"a.txt": "one\nTWO\nthree\n"},
+		},
+		{
+			name:  "body lines that look like file headers",
+			files: map[string]string{"q.sql": "select 1;\n-- comment\nselect 2;\n"},
+			patch: "--- a/q.sql\n+++ b/q.sql\n@@ -1,3 +1,3 @@\n select 1;\n--- comment\n+++ x\n select 2;\n",
+			want:  map[string]string{"q.sql": "select 1;\n++ x\nselect 2;\n"},
+		},
+		{
+			name:  "second file after a hunk",
+			files: map[string]string{"a.txt": "a\n", "b.txt": "b\n"},
+			patch: "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-a\n+A\n--- a/b.txt\n+++ b/b.txt\n@@ -1 +1 @@\n-b\n+B\n",
+			want:  map[string]string{"a.txt": "A\n", "b.txt": "B\n"},
+		},
+		{
+			name:  "create and delete",
+			files: map[string]string{"old.txt": "bye\n"},
+			patch: "--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1,2 @@\n+hello\n+world\n--- a/old.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-bye\n",
+			want:  map[string]string{"new.txt": "hello\nworld\n", "old.txt": ""},
+		},
+		{
+			name:  "adds the final newline",
+			files: map[string]string{"a.txt": "one\ntwo"},
+			patch: "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n one\n-two\n\\ No newline at end of file\n+two\n",
+			want:  map[string]string{"a.txt": "one\ntwo\n"},
+		},
+		{
+			name:  "removes the final newline",
+			files: map[string]string{"a.txt": "one\ntwo\n"},
+			patch: "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n one\n-two\n+two\n\\ No newline at end of file\n",
+			want:  map[string]string{"a.txt": "one\ntwo"},
+		},
+		{
+			name:  "same file in two file patches",
+			files: map[string]string{"a.txt": "one\ntwo\n"},
+			patch: "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-one\n+ONE\n--- a/a.txt\n+++ b/a.txt\n@@ -2 +2 @@\n-two\n+TWO\n",
+			want:  map[string]string{"a.txt": "one\ntwo\n"},
+			err:   "a.txt: changed by more than one file patch",
+		},
+		{
+			name:  "context not found changes nothing",
+			files: map[string]string{"a.txt": "a\n", "b.txt": "b\n"},
+			patch: "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-a\n+A\n--- a/b.txt\n+++ b/b.txt\n@@ -1 +1 @@\n-x\n+X\n",
+			want:  map[string]string{"a.txt": "a\n", "b.txt": "b\n"},
+			err:   "hunk 1 (@@ -1 +1 @@) failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newTestWorkspace(t, tt.files)
+			result, err := NewPatchTool(ws).Execute(context.Background(), map[string]any{"patch": tt.patch})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.err == "" && !result.Success {
+				t.Fatalf("patch failed: %s", result.Error)
+			}
+			if tt.err != "" && (result.Success || !strings.Contains(result.Error, tt.err)) {
+				t.Fatalf("result %+v, want an error containing %q", result, tt.err)
+			}
+			for name, want := range tt.want {
+				data, err := os.ReadFile(filepath.Join(ws.Root(), name))
+				if want == "" {
+					if !os.IsNotExist(err) {
+						t.Errorf("%s still exists", name)
+					}
+					continue
+				}
+				if string(data) != want {
+					t.Errorf("%s = %q, want %q", name, data, want)
+				}
+			}
+		})
+	}
+}
+
+// newTestWorkspace creates a workspace holding the given files
+func newTestWorkspace(t *testing.T, files map[string]string) *Workspace {
+	t.Helper()
+	ws, err := NewWorkspace(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(ws.Root(), name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ws
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package tools
+
+import "os/exec"
+
+// SetProcessGroup is a no-op on platforms without process groups
+func SetProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,627 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DanielNikkari/maahinen/internal/llm"
+)
+
+const (
+	// processOutputLines is how many lines of output are kept per background process
+	processOutputLines = 2000
+	// maxBackgroundProcesses limits how many background processes can run at once
+	maxBackgroundProcesses = 8
+	// processOutputDefault is how many new lines process_output returns when no tail is given
+	processOutputDefault = 200
+	// processStartLines is how much of the early output bash_background returns
+	processStartLines = 20
+)
+
+// ProcessInfo describes a background process
+type ProcessInfo struct {
+	ID       int
+	Command  string
+	PID      int
+	Started  time.Time
+	Ended    time.Time
+	Running  bool
+	Killed   bool
+	ExitCode int
+}
+
+// Status returns a short description of the process state, e.g. "running" or "exited (1)"
+func (p ProcessInfo) Status() string {
+	switch {
+	case p.Running:
+		return "running"
+	case p.Killed:
+		return "killed"
+	default:
+		return fmt.Sprintf("exited (%d)", p.ExitCode)
+	}
+}
+
+// Runtime returns how long the process has been or was running
+func (p ProcessInfo) Runtime() time.Duration {
+	end := p.Ended
+	if p.Running {
+		end = time.Now()
+	}
+	return end.Sub(p.Started).Round(time.Second)
+}
+
+// process is a command started in the background
+type process struct {
+	info   ProcessInfo
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// lines is a ring buffer holding the last processOutputLines lines of output
+	lines []string
+	// total counts every line ever written, read is how many of them were returned already
+	total int
+	read  int
+}
+
+// append adds a line of output, dropping the oldest line when the buffer is full
+func (p *process) append(line string) {
+	if len(p.lines) < processOutputLines {
+		p.lines = append(p.lines, line)
+	} else {
+		p.lines[p.total%processOutputLines] = line
+	}
+	p.total++
+}
+
+// since returns the buffered lines numbered from n on, and how many of them were dropped
+func (p *process) since(n int) ([]string, int) {
+	first := p.total - len(p.lines)
+	dropped := 0
+	if n < first {
+		dropped = first - n
+		n = first
+	}
+	out := make([]string, 0, p.total-n)
+	for i := n; i < p.total; i++ {
+		out = append(out, p.lines[i%processOutputLines])
+	}
+	return out, dropped
+}
+
+// ProcessManager runs commands in the background and keeps their recent output
+// Processes outlive the turn that started them and are killed by KillAll on exit
+type ProcessManager struct {
+	mu       sync.Mutex
+	workDir  string
+	sandbox  *Sandbox
+	procs    map[int]*process
+	nextID   int
+	onChange func()
+}
+
+func NewProcessManager(workDir string) *ProcessManager {
+	return &ProcessManager{
+		workDir: workDir,
+		procs:   make(map[int]*process),
+		nextID:  1,
+	}
+}
+
+func (m *ProcessManager) SetWorkDir(dir string) {
+	m.workDir = dir
+}
+
+// SetSandbox runs new processes in the sandbox, nil runs them directly on the host
+func (m *ProcessManager) SetSandbox(s *Sandbox) {
+	m.sandbox = s
+}
+
+// SetOnChange sets a function called whenever a process starts or ends
+// It is called without the manager's lock held, possibly from another goroutine
+func (m *ProcessManager) SetOnChange(fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onChange = fn
+}
+
+func (m *ProcessManager) changed() {
+	m.mu.Lock()
+	fn := m.onChange
+	m.mu.Unlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+// Start runs a command in the background in dir, or the work directory if dir is empty,
+// and returns its id
+func (m *ProcessManager) Start(command, dir string) (int, error) {
+	m.mu.Lock()
+	running := 0
+	for _, p := range m.procs {
+		if p.info.Running {
+			running++
+		}
+	}
+	if running >= maxBackgroundProcesses {
+		m.mu.Unlock()
+		return 0, fmt.Errorf("%d background processes are already running, kill one with process_kill first", running)
+	}
+
+	if dir == "" {
+		dir = m.workDir
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var cmd *exec.Cmd
+	if m.sandbox != nil {
+		cmd = m.sandbox.command(ctx, command, dir)
+	} else {
+		cmd = exec.CommandContext(ctx, "bash", "-c", command)
+		cmd.Dir = dir
+	}
+	SetProcessGroup(cmd)
+	cmd.WaitDelay = 2 * time.Second
+
+	p := &process{
+		info: ProcessInfo{
+			ID:      m.nextID,
+			Command: command,
+			Started: time.Now(),
+			Running: true,
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	// Both streams go to the same buffer, lines are kept in the order they complete
+	stdout := &lineWriter{mu: &m.mu, fn: p.append}
+	stderr := &lineWriter{mu: &m.mu, fn: p.append}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		m.mu.Unlock()
+		cancel()
+		return 0, fmt.Errorf("failed to start command: %w", err)
+	}
+	p.info.PID = cmd.Process.Pid
+	m.procs[p.info.ID] = p
+	m.nextID++
+	m.mu.Unlock()
+
+	go func() {
+		err := cmd.Wait()
+		stdout.Flush()
+		stderr.Flush()
+
+		m.mu.Lock()
+		p.info.Running = false
+		p.info.Ended = time.Now()
+		p.info.ExitCode = cmd.ProcessState.ExitCode()
+		if err != nil && ctx.Err() != nil {
+			p.info.Killed = true
+		}
+		m.mu.Unlock()
+		cancel()
+		close(p.done)
+		m.changed()
+	}()
+
+	m.changed()
+	return p.info.ID, nil
+}
+
+// Output returns the output of a process
+// With tail > 0 the last tail lines are returned, otherwise the lines printed since the
+// previous call. dropped counts lines that were no longer buffered
+func (m *ProcessManager) Output(id, tail int) (info ProcessInfo, lines []string, dropped int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.procs[id]
+	if !ok {
+		return ProcessInfo{}, nil, 0, fmt.Errorf("no background process with id %d", id)
+	}
+	if tail > 0 {
+		lines, _ = p.since(max(0, p.total-tail))
+	} else {
+		lines, dropped = p.since(p.read)
+	}
+	p.read = p.total
+	return p.info, lines, dropped, nil
+}
+
+// Kill stops a process and everything it started, waiting for it to exit
+func (m *ProcessManager) Kill(id int) (ProcessInfo, error) {
+	m.mu.Lock()
+	p, ok := m.procs[id]
+	m.mu.Unlock()
+	if !ok {
+		return ProcessInfo{}, fmt.Errorf("no background process with id %d", id)
+	}
+
+	p.cancel()
+	<-p.done
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return p.info, nil
+}
+
+// KillAll stops every running process
+func (m *ProcessManager) KillAll() {
+	m.mu.Lock()
+	procs := make([]*process, 0, len(m.procs))
+	for _, p := range m.procs {
+		procs = append(procs, p)
+	}
+	m.mu.Unlock()
+
+	for _, p := range procs {
+		p.cancel()
+	}
+	for _, p := range procs {
+		<-p.done
+	}
+}
+
+// List returns every process started in this session, oldest first
+func (m *ProcessManager) List() []ProcessInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	infos := make([]ProcessInfo, 0, len(m.procs))
+	for _, p := range m.procs {
+		infos = append(infos, p.info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// processID reads the id argument of the process tools
+func processID(args map[string]any) (int, bool) {
+	id := intArg(args, "id", 0)
+	return id, id > 0
+}
+
+// BackgroundTool starts a command that keeps running after the tool call returns
+type BackgroundTool struct {
+	procs *ProcessManager
+	shell *BashTool
+}
+
+func NewBackgroundTool(procs *ProcessManager) *BackgroundTool {
+	return &BackgroundTool{procs: procs}
+}
+
+// FollowShell starts commands in the bash tool's current directory, so they start where
+// a cd in an earlier bash call left the shell
+func (t *BackgroundTool) FollowShell(b *BashTool) {
+	t.shell = b
+}
+
+func (t *BackgroundTool) Name() string {
+	return "bash_background"
+}
+
+func (t *BackgroundTool) Description() string {
+	return "Start a long-running bash command in the background"
+}
+
+func (t *BackgroundTool) Aliases() []string {
+	return []string{"background", "bash_bg", "run_background", "start_process"}
+}
+
+func (t *BackgroundTool) Execute(ctx context.Context, args map[string]any) (Result, error) {
+	command, ok := args["command"].(string)
+	if !ok || command == "" {
+		return Result{
+			Success: false,
+			Error:   "missing or invalid 'command' argument",
+		}, nil
+	}
+
+	dir := t.procs.workDir
+	if t.shell != nil {
+		dir = t.shell.CurrentDir()
+	}
+	if arg, _ := args["cwd"].(string); arg != "" {
+		dir = resolveDir(dir, arg)
+	}
+	if info, err := os.Stat(dir); dir != "" && (err != nil || !info.IsDir()) {
+		return Result{
+			Success: false,
+			Error:   fmt.Sprintf("cwd %s does not exist or is not a directory", dir),
+		}, nil
+	}
+
+	id, err := t.procs.Start(command, dir)
+	if err != nil {
+		return Result{Success: false, Error: err.Error()}, nil
+	}
+
+	// Give commands that fail right away a moment to do so
+	select {
+	case <-time.After(500 * time.Millisecond):
+	case <-ctx.Done():
+	}
+	info, lines, dropped, _ := t.procs.Output(id, 0)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Started background process %d (pid %d) in %s: %s\n", id, info.PID, dir, command)
+	if !info.Running {
+		fmt.Fprintf(&sb, "The process already %s.\n", info.Status())
+	} else {
+		sb.WriteString("Use process_output to check its output and process_kill to stop it.\n")
+	}
+	if len(lines) > 0 {
+		sb.WriteString("Output so far:\n")
+		if len(lines) > processStartLines {
+			dropped += len(lines) - processStartLines
+			lines = lines[len(lines)-processStartLines:]
+		}
+		if dropped > 0 {
+			fmt.Fprintf(&sb, "[%d earlier lines not shown]\n", dropped)
+		}
+		sb.WriteString(strings.Join(lines, "\n"))
+	}
+	return Result{
+		Success: info.Running || info.ExitCode == 0,
+		Output:  strings.TrimRight(sb.String(), "\n"),
+	}, nil
+}
+
+func BackgroundToolDefinition() llm.Tool {
+	return llm.Tool{
+		Type: "function",
+		Function: llm.ToolDefinition{
+			Name:        "bash_background",
+			Description: "Start a bash command in the background and return immediately with its process id. Use this for dev servers, file watchers and long test suites instead of bash, which times out. Check on it with process_output and stop it with process_kill.",
+			Parameters: llm.Parameters{
+				Type: "object",
+				Properties: map[string]llm.Property{
+					"command": {
+						Type:        "string",
+						Description: "The bash command to run",
+					},
+					"cwd": {
+						Type:        "string",
+						Description: "Directory to start the command in (optional), relative to the bash tool's current directory, which it defaults to",
+					},
+				},
+				Required: []string{"command"},
+			},
+		},
+	}
+}
+
+func (t *BackgroundTool) Definition() llm.Tool {
+	def := BackgroundToolDefinition()
+	if t.procs.sandbox != nil {
+		def.Function.Description += " " + t.procs.sandbox.note()
+	}
+	return def
+}
+
+// ProcessOutputTool returns the output of a background process
+// It is not read-only: each check moves the "since last check" cursor, so two checks
+// running at once would split the new output between them
+type ProcessOutputTool struct {
+	procs *ProcessManager
+}
+
+func NewProcessOutputTool(procs *ProcessManager) *ProcessOutputTool {
+	return &ProcessOutputTool{procs: procs}
+}
+
+func (t *ProcessOutputTool) Name() string {
+	return "process_output"
+}
+
+func (t *ProcessOutputTool) Description() string {
+	return "Show the output of a background process"
+}
+
+func (t *ProcessOutputTool) Aliases() []string {
+	return []string{"process_logs", "read_output", "get_output"}
+}
+
+func (t *ProcessOutputTool) Execute(ctx context.Context, args map[string]any) (Result, error) {
+	id, ok := processID(args)
+	if !ok {
+		return Result{
+			Success: false,
+			Error:   "missing or invalid 'id' argument",
+		}, nil
+	}
+	tail := max(0, intArg(args, "tail", 0))
+
+	info, lines, dropped, err := t.procs.Output(id, tail)
+	if err != nil {
+		return Result{Success: false, Error: err.Error()}, nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Process %d (%s, %s): %s\n", info.ID, info.Status(), info.Runtime(), info.Command)
+	if tail == 0 && len(lines) > processOutputDefault {
+		dropped += len(lines) - processOutputDefault
+		lines = lines[len(lines)-processOutputDefault:]
+	}
+	if dropped > 0 {
+		fmt.Fprintf(&sb, "[%d earlier lines not shown]\n", dropped)
+	}
+	if len(lines) == 0 {
+		if tail > 0 {
+			sb.WriteString("No output.")
+		} else {
+			sb.WriteString("No new output since the last check.")
+		}
+	}
+	sb.WriteString(strings.Join(lines, "\n"))
+
+	return Result{Success: true, Output: sb.String()}, nil
+}
+
+func ProcessOutputToolDefinition() llm.Tool {
+	return llm.Tool{
+		Type: "function",
+		Function: llm.ToolDefinition{
+			Name:        "process_output",
+			Description: "Show the output a background process printed since the last check, along with its status. Use tail to see the last lines instead.",
+			Parameters: llm.Parameters{
+				Type: "object",
+				Properties: map[string]llm.Property{
+					"id": {
+						Type:        "integer",
+						Description: "The id returned by bash_background",
+						Minimum:     llm.Bound(1),
+					},
+					"tail": {
+						Type:        "integer",
+						Description: "Return the last N lines of output instead of the new output (optional)",
+						Minimum:     llm.Bound(1),
+					},
+				},
+				Required: []string{"id"},
+			},
+		},
+	}
+}
+
+func (t *ProcessOutputTool) Definition() llm.Tool {
+	return ProcessOutputToolDefinition()
+}
+
+// ProcessKillTool stops a background process
+type ProcessKillTool struct {
+	procs *ProcessManager
+}
+
+func NewProcessKillTool(procs *ProcessManager) *ProcessKillTool {
+	return &ProcessKillTool{procs: procs}
+}
+
+func (t *ProcessKillTool) Name() string {
+	return "process_kill"
+}
+
+func (t *ProcessKillTool) Description() string {
+	return "Stop a background process"
+}
+
+func (t *ProcessKillTool) Aliases() []string {
+	return []string{"kill", "kill_process", "stop_process"}
+}
+
+func (t *ProcessKillTool) Execute(ctx context.Context, args map[string]any) (Result, error) {
+	id, ok := processID(args)
+	if !ok {
+		return Result{
+			Success: false,
+			Error:   "missing or invalid 'id' argument",
+		}, nil
+	}
+
+	info, err := t.procs.Kill(id)
+	if err != nil {
+		return Result{Success: false, Error: err.Error()}, nil
+	}
+	if !info.Killed {
+		return Result{
+			Success: true,
+			Output:  fmt.Sprintf("Process %d had already %s", id, info.Status()),
+		}, nil
+	}
+	return Result{
+		Success: true,
+		Output:  fmt.Sprintf("Process %d killed after %s", id, info.Runtime()),
+	}, nil
+}
+
+func ProcessKillToolDefinition() llm.Tool {
+	return llm.Tool{
+		Type: "function",
+		Function: llm.ToolDefinition{
+			Name:        "process_kill",
+			Description: "Stop a background process started with bash_background, along with any processes it started.",
+			Parameters: llm.Parameters{
+				Type: "object",
+				Properties: map[string]llm.Property{
+					"id": {
+						Type:        "integer",
+						Description: "The id returned by bash_background",
+						Minimum:     llm.Bound(1),
+					},
+				},
+				Required: []string{"id"},
+			},
+		},
+	}
+}
+
+func (t *ProcessKillTool) Definition() llm.Tool {
+	return ProcessKillToolDefinition()
+}
+
+// ProcessListTool lists the background processes
+type ProcessListTool struct {
+	procs *ProcessManager
+}
+
+func NewProcessListTool(procs *ProcessManager) *ProcessListTool {
+	return &ProcessListTool{procs: procs}
+}
+
+func (t *ProcessListTool) Name() string {
+	return "process_list"
+}
+
+func (t *ProcessListTool) Description() string {
+	return "List background processes"
+}
+
+func (t *ProcessListTool) Aliases() []string {
+	return []string{"list_processes", "ps", "processes"}
+}
+
+// ReadOnly reports that listing processes has no side effects
+func (t *ProcessListTool) ReadOnly() bool {
+	return true
+}
+
+func (t *ProcessListTool) Execute(ctx context.Context, args map[string]any) (Result, error) {
+	infos := t.procs.List()
+	if len(infos) == 0 {
+		return Result{Success: true, Output: "No background processes"}, nil
+	}
+
+	var sb strings.Builder
+	for _, info := range infos {
+		fmt.Fprintf(&sb, "%d  %-11s %-6s pid %-7d %s\n", info.ID, info.Status(), info.Runtime(), info.PID, info.Command)
+	}
+	return Result{Success: true, Output: strings.TrimRight(sb.String(), "\n")}, nil
+}
+
+func ProcessListToolDefinition() llm.Tool {
+	return llm.Tool{
+		Type: "function",
+		Function: llm.ToolDefinition{
+			Name:        "process_list",
+			Description: "List the background processes started with bash_background with their id, status, runtime and command.",
+			Parameters: llm.Parameters{
+				Type:       "object",
+				Properties: map[string]llm.Property{},
+			},
+		},
+	}
+}
+
+func (t *ProcessListTool) Definition() llm.Tool {
+	return ProcessListToolDefinition()
+}
@@ -0,0 +1,56 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackgroundFollowsShell(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"sub", "other"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bash := NewBashTool(root)
+	procs := NewProcessManager(root)
+	t.Cleanup(procs.KillAll)
+	background := NewBackgroundTool(procs)
+	background.FollowShell(bash)
+
+	if result, _ := bash.Execute(context.Background(), map[string]any{"command": "cd sub"}); !result.Success {
+		t.Fatalf("cd failed: %s", result.Error)
+	}
+
+	tests := []struct {
+		name string
+		args map[string]any
+		want string
+	}{
+		{"shell directory", map[string]any{"command": "pwd"}, filepath.Join(root, "sub")},
+		{"cwd argument", map[string]any{"command": "pwd", "cwd": "../other"}, filepath.Join(root, "other")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := background.Execute(context.Background(), tt.args)
+			if err != nil || !result.Success {
+				t.Fatalf("bash_background failed: %v %s", err, result.Error)
+			}
+			if !strings.HasSuffix(result.Output, "\n"+tt.want) {
+				t.Errorf("output %q, want the command to print %s", result.Output, tt.want)
+			}
+		})
+	}
+
+	result, _ := background.Execute(context.Background(), map[string]any{"command": "pwd", "cwd": "missing"})
+	if result.Success || !strings.Contains(result.Error, "does not exist") {
+		t.Errorf("missing cwd result %+v, want an error", result)
+	}
+}
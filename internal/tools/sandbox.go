@@ -0,0 +1,68 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SandboxOptions configures the sandbox bash commands run in
+type SandboxOptions struct {
+	// Network allows network access, it is off by default
+	Network bool
+	// Writable lists directories besides the workspace that commands may write to
+	Writable []string
+	// CPUSeconds limits the CPU time of each command, 0 for no limit
+	CPUSeconds int
+	// MemoryMB limits the virtual memory of each process, 0 for no limit
+	MemoryMB int
+	// MaxProcesses limits the number of processes, 0 for no limit
+	// It is RLIMIT_NPROC, which counts all processes of the user outside the sandbox too
+	MaxProcesses int
+}
+
+// Sandbox runs bash commands isolated from the host
+// Only the workspace and the extra writable directories can be written to, the rest of
+// the filesystem is read-only and /tmp is private to the command
+type Sandbox struct {
+	root     string
+	writable []string
+	opts     SandboxOptions
+	// bwrap is the path of bubblewrap, empty when namespaces are set up directly
+	bwrap string
+}
+
+// Mode describes how commands are isolated
+func (s *Sandbox) Mode() string {
+	if s.bwrap != "" {
+		return "bubblewrap"
+	}
+	return "namespaces"
+}
+
+// limits returns the ulimit command applying the resource limits
+// Without -S or -H ulimit sets the hard limit too, so commands cannot raise them again
+func (s *Sandbox) limits() string {
+	var flags []string
+	if s.opts.CPUSeconds > 0 {
+		flags = append(flags, fmt.Sprintf("-t %d", s.opts.CPUSeconds))
+	}
+	if s.opts.MemoryMB > 0 {
+		flags = append(flags, fmt.Sprintf("-v %d", s.opts.MemoryMB*1024))
+	}
+	if s.opts.MaxProcesses > 0 {
+		flags = append(flags, fmt.Sprintf("-u %d", s.opts.MaxProcesses))
+	}
+	if len(flags) == 0 {
+		return ":"
+	}
+	return "ulimit " + strings.Join(flags, " ")
+}
+
+// note tells the model what the sandbox doesn't allow
+func (s *Sandbox) note() string {
+	note := "Commands run in a sandbox: only the workspace directory can be written to"
+	if !s.opts.Network {
+		note += " and there is no network access"
+	}
+	return note + "."
+}
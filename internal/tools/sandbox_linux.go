@@ -0,0 +1,161 @@
+//go:build linux
+
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// namespaceScript sets up the sandbox inside new user and mount namespaces when
+// bubblewrap isn't installed. It runs as root of the user namespace
+// Arguments: working directory, ulimit command, command, writable directories...
+const namespaceScript = `set -e
+dir=$1 limits=$2 cmd=$3
+shift 3
+
+# Keep handles on the writable directories, the private /tmp may hide them
+fds=()
+for p in "$@"; do
+	exec {fd}<"$p"
+	fds+=("$fd")
+done
+
+# Make every mount read-only. Flags locked by the user namespace must be kept
+# for the remount to be allowed. Only kernel filesystems, which don't hold files
+# commands could write to, may stay as they are
+mapfile -t mounts < /proc/self/mountinfo
+for line in "${mounts[@]}"; do
+	read -r _ _ _ _ mp opts _ <<< "$line"
+	fstype=${line#* - }
+	fstype=${fstype%% *}
+	path=$(printf '%b' "$mp")
+	flags=ro
+	for o in ${opts//,/ }; do
+		case $o in
+		nosuid|nodev|noexec|noatime|nodiratime|relatime|strictatime) flags+=",$o" ;;
+		esac
+	done
+	mount -o "remount,bind,$flags" "$path" 2>/dev/null && continue
+	case $fstype in
+	proc|sysfs|cgroup|cgroup2|devpts|devtmpfs|mqueue|debugfs|tracefs|securityfs|pstore|bpf|configfs|fusectl|hugetlbfs|binfmt_misc|autofs|nsfs|efivarfs) ;;
+	*)
+		echo "sandbox: could not make $path read-only, refusing to run the command" >&2
+		exit 125
+		;;
+	esac
+done
+
+mount -t tmpfs tmpfs /tmp
+
+# Bind the writable directories back over themselves
+i=0
+for p in "$@"; do
+	mkdir -p "$p"
+	mount --no-canonicalize --bind "/proc/self/fd/${fds[i]}" "$p"
+	mount -o remount,bind,rw "$p"
+	fd=${fds[i]}
+	exec {fd}<&-
+	i=$((i+1))
+done
+
+cd "$dir"
+eval "$limits"
+exec bash -c "$cmd"
+`
+
+// NewSandbox creates a sandbox that lets commands write to root and the writable directories
+// bubblewrap is used when installed, otherwise user, mount and network namespaces are
+// set up directly. An error is returned if neither works on this system
+func NewSandbox(root string, opts SandboxOptions) (*Sandbox, error) {
+	s := &Sandbox{root: root, opts: opts}
+	for _, dir := range append([]string{root}, opts.Writable...) {
+		dir, err := filepath.Abs(expandHome(dir))
+		if err != nil {
+			return nil, fmt.Errorf("invalid sandbox directory: %w", err)
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("sandbox directory %s does not exist or is not a directory", dir)
+		}
+		s.writable = append(s.writable, dir)
+	}
+
+	var errs []string
+	if bwrap, err := exec.LookPath("bwrap"); err == nil {
+		s.bwrap = bwrap
+		err := s.check()
+		if err == nil {
+			return s, nil
+		}
+		errs = append(errs, fmt.Sprintf("bubblewrap: %v", err))
+		s.bwrap = ""
+	}
+	if err := s.check(); err != nil {
+		errs = append(errs, fmt.Sprintf("namespaces: %v", err))
+		return nil, fmt.Errorf("sandbox is not available (%s)", strings.Join(errs, "; "))
+	}
+	return s, nil
+}
+
+// check runs a command in the sandbox to see that it can be set up
+func (s *Sandbox) check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cmd := s.command(ctx, "true", s.root)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// command returns the command running a bash command in the sandbox
+func (s *Sandbox) command(ctx context.Context, command, dir string) *exec.Cmd {
+	if dir == "" {
+		dir = s.root
+	}
+
+	if s.bwrap == "" {
+		args := append([]string{"-c", namespaceScript, "sandbox", dir, s.limits(), command}, s.writable...)
+		cmd := exec.CommandContext(ctx, "bash", args...)
+
+		flags := syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+		if !s.opts.Network {
+			flags |= syscall.CLONE_NEWNET
+		}
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Cloneflags:  uintptr(flags),
+			UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+			GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		}
+		return cmd
+	}
+
+	args := []string{
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+	}
+	for _, w := range s.writable {
+		args = append(args, "--bind", w, w)
+	}
+	args = append(args, "--unshare-user", "--unshare-pid", "--unshare-ipc", "--unshare-uts", "--die-with-parent")
+	if !s.opts.Network {
+		args = append(args, "--unshare-net")
+	}
+	args = append(args, "--chdir", dir, "bash", "-c", s.limits()+` && exec bash -c "$1"`, "sandbox", command)
+	return exec.CommandContext(ctx, s.bwrap, args...)
+}
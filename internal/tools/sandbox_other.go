@@ -0,0 +1,21 @@
+//go:build !linux
+
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// NewSandbox reports that sandboxing is only supported on Linux
+func NewSandbox(root string, opts SandboxOptions) (*Sandbox, error) {
+	return nil, fmt.Errorf("sandbox is only supported on Linux")
+}
+
+// command is never used since no sandbox can be created on this platform
+func (s *Sandbox) command(ctx context.Context, command, dir string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	cmd.Dir = dir
+	return cmd
+}
@@ -0,0 +1,307 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/DanielNikkari/maahinen/internal/llm"
+)
+
+// ValidationError lists what was wrong with the arguments of a tool call
+// Its message is written for the model, so it can correct the call and try again
+type ValidationError struct {
+	Tool     string
+	Problems []string
+	// Expected describes the tool's parameters
+	Expected string
+}
+
+func (e *ValidationError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Invalid arguments for tool '%s':\n", e.Tool)
+	for _, p := range e.Problems {
+		sb.WriteString("- " + p + "\n")
+	}
+	if e.Expected != "" {
+		sb.WriteString("Expected arguments:\n" + e.Expected)
+	}
+	sb.WriteString("Fix the arguments and call the tool again.")
+	return sb.String()
+}
+
+// Validate checks the arguments of a call against the tool's definition
+// Common mistakes are corrected rather than rejected: numbers and booleans sent as strings,
+// arrays and objects sent as JSON strings and single values where an array is expected.
+// Missing optional arguments with a default get it. Returns the corrected arguments, or a
+// *ValidationError. Calls to unknown tools are returned unchanged
+func (r *Registry) Validate(name string, args map[string]any) (map[string]any, error) {
+	t, ok := r.Get(name)
+	if !ok {
+		return args, nil
+	}
+	params := t.Definition().Function.Parameters
+
+	v := &validator{}
+	out := v.object("", args, params.Properties, params.Required)
+	if len(v.problems) == 0 {
+		return out, nil
+	}
+
+	// Arguments the tool doesn't know are often misnamed ones
+	for _, key := range sortedKeys(args) {
+		if _, ok := params.Properties[key]; !ok {
+			v.problems = append(v.problems, fmt.Sprintf("unknown argument '%s'", key))
+		}
+	}
+	return nil, &ValidationError{
+		Tool:     name,
+		Problems: v.problems,
+		Expected: describeParams(params),
+	}
+}
+
+// DecodeError returns the error for a call whose arguments could not be decoded, listing
+// the tool's parameters like a failed validation. Returns nil for unknown tools
+func (r *Registry) DecodeError(name, problem string) error {
+	t, ok := r.Get(name)
+	if !ok {
+		return nil
+	}
+	return &ValidationError{
+		Tool:     name,
+		Problems: []string{problem},
+		Expected: describeParams(t.Definition().Function.Parameters),
+	}
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) fail(format string, args ...any) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+// object validates the fields of an object, prefix is the path of the object itself
+func (v *validator) object(prefix string, args map[string]any, props map[string]llm.Property, required []string) map[string]any {
+	out := make(map[string]any, len(args))
+	for key, value := range args {
+		out[key] = value
+	}
+
+	for _, key := range required {
+		if value, ok := out[key]; !ok || value == nil {
+			p := props[key]
+			v.fail("missing required argument '%s' (%s)", prefix+key, p.Type)
+		}
+	}
+
+	for _, key := range sortedKeys(props) {
+		p := props[key]
+		value, ok := out[key]
+		if ok && value == nil {
+			// null is how some models leave out an optional argument
+			delete(out, key)
+			ok = false
+		}
+		if !ok {
+			if p.Default != nil {
+				out[key] = p.Default
+			}
+			continue
+		}
+		out[key] = v.value(prefix+key, value, p)
+	}
+	return out
+}
+
+// value checks a single argument against its property, coercing it where possible
+func (v *validator) value(path string, value any, p llm.Property) any {
+	switch p.Type {
+	case "string":
+		var s string
+		switch val := value.(type) {
+		case string:
+			s = val
+		case float64:
+			// 'f' keeps numbers like 100000000 from turning into 1e+08
+			s = strconv.FormatFloat(val, 'f', -1, 64)
+		case bool:
+			s = strconv.FormatBool(val)
+		default:
+			v.fail("argument '%s' must be a string, got %s", path, describeValue(value))
+			return value
+		}
+		if len(p.Enum) > 0 {
+			for _, e := range p.Enum {
+				if strings.EqualFold(s, e) {
+					return e
+				}
+			}
+			v.fail("argument '%s' must be one of %s, got %q", path, strings.Join(p.Enum, ", "), s)
+		}
+		return s
+
+	case "integer", "number":
+		n, ok := toNumber(value)
+		if !ok {
+			v.fail("argument '%s' must be %s, got %s", path, article(p.Type), describeValue(value))
+			return value
+		}
+		if p.Type == "integer" && n != math.Trunc(n) {
+			v.fail("argument '%s' must be a whole number, got %v", path, n)
+			return value
+		}
+		if p.Minimum != nil && n < *p.Minimum {
+			v.fail("argument '%s' must be at least %v, got %v", path, *p.Minimum, n)
+		}
+		if p.Maximum != nil && n > *p.Maximum {
+			v.fail("argument '%s' must be at most %v, got %v", path, *p.Maximum, n)
+		}
+		return n
+
+	case "boolean":
+		switch val := value.(type) {
+		case bool:
+			return val
+		case string:
+			switch strings.ToLower(strings.TrimSpace(val)) {
+			case "true", "yes", "1":
+				return true
+			case "false", "no", "0", "":
+				return false
+			}
+		case float64:
+			if val == 0 || val == 1 {
+				return val == 1
+			}
+		}
+		v.fail("argument '%s' must be true or false, got %s", path, describeValue(value))
+		return value
+
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			if s, isString := value.(string); !isString || !decodeJSONString(s, &items) {
+				// A single value where a list is expected
+				items = []any{value}
+			}
+		}
+		if p.Items == nil {
+			return items
+		}
+		out := make([]any, len(items))
+		for i, item := range items {
+			out[i] = v.value(fmt.Sprintf("%s[%d]", path, i), item, *p.Items)
+		}
+		return out
+
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			if s, isString := value.(string); !isString || !decodeJSONString(s, &obj) {
+				v.fail("argument '%s' must be an object, got %s", path, describeValue(value))
+				return value
+			}
+		}
+		if p.Properties == nil {
+			return obj
+		}
+		return v.object(path+".", obj, p.Properties, p.Required)
+	}
+	return value
+}
+
+// toNumber reads a number, accepting numbers written as strings
+func toNumber(value any) (float64, bool) {
+	switch val := value.(type) {
+	case float64:
+		return val, true
+	case int:
+		return float64(val), true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// decodeJSONString decodes an array or object that was sent as a JSON string
+func decodeJSONString(s string, v any) bool {
+	s = strings.TrimSpace(s)
+	if s == "" || (s[0] != '[' && s[0] != '{') {
+		return false
+	}
+	return json.Unmarshal([]byte(s), v) == nil
+}
+
+// describeValue names the JSON type of a value for error messages
+func describeValue(value any) string {
+	switch val := value.(type) {
+	case string:
+		if len(val) > 40 {
+			val = val[:37] + "..."
+		}
+		return fmt.Sprintf("the string %q", val)
+	case float64:
+		return fmt.Sprintf("the number %v", val)
+	case bool:
+		return fmt.Sprintf("%v", val)
+	case []any:
+		return "an array"
+	case map[string]any:
+		return "an object"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func article(typ string) string {
+	if typ == "integer" {
+		return "an integer"
+	}
+	return "a " + typ
+}
+
+// describeParams lists a tool's parameters, one per line
+func describeParams(params llm.Parameters) string {
+	if len(params.Properties) == 0 {
+		return "(none)\n"
+	}
+	required := map[string]bool{}
+	for _, name := range params.Required {
+		required[name] = true
+	}
+
+	var sb strings.Builder
+	for _, name := range sortedKeys(params.Properties) {
+		p := params.Properties[name]
+		typ := p.Type
+		if p.Type == "array" && p.Items != nil {
+			typ = "array of " + p.Items.Type
+		}
+		if required[name] {
+			typ += ", required"
+		}
+		fmt.Fprintf(&sb, "- %s (%s)", name, typ)
+		if p.Description != "" {
+			sb.WriteString(": " + p.Description)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,206 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DanielNikkari/maahinen/internal/llm"
+)
+
+// schemaTool only has a definition, for validating arguments against
+type schemaTool struct {
+	params llm.Parameters
+}
+
+func (t *schemaTool) Name() string        { return "sample" }
+func (t *schemaTool) Description() string { return "A tool with one parameter of each type" }
+func (t *schemaTool) Definition() llm.Tool {
+	return llm.Tool{
+		Type:     "function",
+		Function: llm.ToolDefinition{Name: "sample", Parameters: t.params},
+	}
+}
+func (t *schemaTool) Execute(ctx context.Context, args map[string]any) (Result, error) {
+	return Result{Success: true}, nil
+}
+
+func TestValidate(t *testing.T) {
+	r := NewRegistry()
+	r.Register(&schemaTool{params: llm.Parameters{
+		Type: "object",
+		Properties: map[string]llm.Property{
+			"path":  {Type: "string"},
+			"count": {Type: "integer", Minimum: llm.Bound(1), Maximum: llm.Bound(10)},
+			"ratio": {Type: "number"},
+			"force": {Type: "boolean"},
+			"mode":  {Type: "string", Enum: []string{"fast", "safe"}, Default: "safe"},
+			"tags":  {Type: "array", Items: &llm.Property{Type: "string"}},
+			"sizes": {Type: "array", Items: &llm.Property{Type: "integer"}},
+			"opts": {Type: "object", Properties: map[string]llm.Property{
+				"depth": {Type: "integer"},
+			}, Required: []string{"depth"}},
+		},
+		Required: []string{"path"},
+	}})
+
+	tests := []struct {
+		name string
+		args map[string]any
+		want map[string]any
+	}{
+		{
+			name: "valid arguments get defaults",
+			args: map[string]any{"path": "a.go", "count": 3.0},
+			want: map[string]any{"path": "a.go", "count": 3.0, "mode": "safe"},
+		},
+		{
+			name: "numbers and booleans sent as strings",
+			args: map[string]any{"path": "a.go", "count": " 4 ", "ratio": "0.5", "force": "yes"},
+			want: map[string]any{"path": "a.go", "count": 4.0, "ratio": 0.5, "force": true, "mode": "safe"},
+		},
+		{
+			name: "numbers and booleans sent for strings",
+			args: map[string]any{"path": 100000000.0, "mode": "FAST"},
+			want: map[string]any{"path": "100000000", "mode": "fast"},
+		},
+		{
+			name: "boolean path",
+			args: map[string]any{"path": true},
+			want: map[string]any{"path": "true", "mode": "safe"},
+		},
+		{
+			name: "arrays sent as JSON strings",
+			args: map[string]any{"path": "a", "tags": `["x", "y"]`, "sizes": `[1, "2"]`},
+			want: map[string]any{"path": "a", "tags": []any{"x", "y"}, "sizes": []any{1.0, 2.0}, "mode": "safe"},
+		},
+		{
+			name: "single value for an array",
+			args: map[string]any{"path": "a", "tags": "x"},
+			want: map[string]any{"path": "a", "tags": []any{"x"}, "mode": "safe"},
+		},
+		{
+			name: "object sent as a JSON string",
+			args: map[string]any{"path": "a", "opts": `{"depth": "2"}`},
+			want: map[string]any{"path": "a", "opts": map[string]any{"depth": 2.0}, "mode": "safe"},
+		},
+		{
+			name: "null optional arguments are left out",
+			args: map[string]any{"path": "a", "count": nil, "mode": nil},
+			want: map[string]any{"path": "a", "mode": "safe"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Validate("sample", tt.args)
+			if err != nil {
+				t.Fatalf("Validate failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	r := NewRegistry()
+	r.Register(&schemaTool{params: llm.Parameters{
+		Type: "object",
+		Properties: map[string]llm.Property{
+			"path":  {Type: "string"},
+			"count": {Type: "integer", Minimum: llm.Bound(1), Maximum: llm.Bound(10)},
+			"force": {Type: "boolean"},
+			"mode":  {Type: "string", Enum: []string{"fast", "safe"}},
+			"sizes": {Type: "array", Items: &llm.Property{Type: "integer"}},
+			"opts":  {Type: "object"},
+		},
+		Required: []string{"path"},
+	}})
+
+	tests := []struct {
+		name string
+		args map[string]any
+		want []string
+	}{
+		{
+			name: "missing required argument and a misnamed one",
+			args: map[string]any{"file": "a.go"},
+			want: []string{"missing required argument 'path' (string)", "unknown argument 'file'"},
+		},
+		{
+			name: "number out of range",
+			args: map[string]any{"path": "a", "count": 11.0},
+			want: []string{"argument 'count' must be at most 10, got 11"},
+		},
+		{
+			name: "fraction for an integer",
+			args: map[string]any{"path": "a", "count": "2.5"},
+			want: []string{"argument 'count' must be a whole number, got 2.5"},
+		},
+		{
+			name: "text for a number",
+			args: map[string]any{"path": "a", "count": "many"},
+			want: []string{`argument 'count' must be an integer, got the string "many"`},
+		},
+		{
+			name: "unknown enum value",
+			args: map[string]any{"path": "a", "mode": "slow"},
+			want: []string{`argument 'mode' must be one of fast, safe, got "slow"`},
+		},
+		{
+			name: "bad boolean",
+			args: map[string]any{"path": "a", "force": "maybe"},
+			want: []string{`argument 'force' must be true or false, got the string "maybe"`},
+		},
+		{
+			name: "bad array item",
+			args: map[string]any{"path": "a", "sizes": []any{1.0, "x"}},
+			want: []string{`argument 'sizes[1]' must be an integer, got the string "x"`},
+		},
+		{
+			name: "object that isn't JSON",
+			args: map[string]any{"path": "a", "opts": "depth=2"},
+			want: []string{`argument 'opts' must be an object, got the string "depth=2"`},
+		},
+		{
+			name: "object for a string",
+			args: map[string]any{"path": map[string]any{"name": "a"}},
+			want: []string{"argument 'path' must be a string, got an object"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.Validate("sample", tt.args)
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate error %v, want a *ValidationError", err)
+			}
+			if !reflect.DeepEqual(verr.Problems, tt.want) {
+				t.Errorf("problems %q, want %q", verr.Problems, tt.want)
+			}
+			if !strings.Contains(err.Error(), "- path (string, required)") {
+				t.Errorf("error doesn't describe the expected arguments:\n%s", err)
+			}
+		})
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	r := newTestRegistry(t)
+
+	err := r.DecodeError("read", `arguments are not a valid JSON object: {"path": "a.go"`)
+	if err == nil {
+		t.Fatal("DecodeError returned nil for a known tool")
+	}
+	for _, want := range []string{`{"path": "a.go"`, "- path (string, required)", "Fix the arguments"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error doesn't contain %q:\n%s", want, err)
+		}
+	}
+	if err := r.DecodeError("launch_rockets", "bad"); err != nil {
+		t.Errorf("DecodeError for an unknown tool = %v, want nil", err)
+	}
+}
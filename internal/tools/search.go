@@ -0,0 +1,228 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/DanielNikkari/maahinen/internal/llm"
+)
+
+const (
+	// Most matches reported for a single file
+	searchMaxMatchesPerFile = 20
+	// Most matches reported in total
+	searchMaxMatches = 200
+	// Longest output returned to the model
+	searchMaxOutput = 20000
+	// Longest line shown for a match
+	searchMaxLineLength = 200
+	// Files larger than this are not searched
+	searchMaxFileSize = 5 * 1024 * 1024
+)
+
+type SearchTool struct {
+	ws *Workspace
+}
+
+func NewSearchTool(ws *Workspace) *SearchTool {
+	return &SearchTool{ws: ws}
+}
+
+func (t *SearchTool) Name() string { return "search" }
+func (t *SearchTool) Description() string {
+	return "Search file contents for a regex or literal string"
+}
+
+func (t *SearchTool) Aliases() []string {
+	return []string{"grep", "rg", "find_in_files", "search_files", "search_code"}
+}
+
+func (t *SearchTool) Execute(ctx context.Context, args map[string]any) (Result, error) {
+	pattern, ok := args["pattern"].(string)
+	if !ok || pattern == "" {
+		return Result{Success: false, Error: "missing 'pattern' argument"}, nil
+	}
+
+	if boolArg(args, "literal") {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if boolArg(args, "ignore_case") {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Result{Success: false, Error: fmt.Sprintf("invalid regex: %v (set literal=true to search for the exact text)", err)}, nil
+	}
+
+	path, ok := args["path"].(string)
+	if !ok || path == "" {
+		path = "."
+	}
+	root, err := t.ws.Resolve(path)
+	if err != nil {
+		return Result{Success: false, Error: err.Error()}, nil
+	}
+
+	include, _ := args["include"].(string)
+	exclude, _ := args["exclude"].(string)
+	includes := splitPatterns(include)
+	excludes := splitPatterns(exclude)
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return Result{Success: false, Error: err.Error()}, nil
+	}
+
+	s := &searcher{re: re}
+	if !info.IsDir() {
+		// A single file is searched even if it would be ignored when walking
+		s.searchFile(root, path)
+	} else {
+		err = walkWorkspace(ctx, root, func(rel string, d fs.DirEntry) error {
+			if len(includes) > 0 && !matchAnyGlob(includes, rel) {
+				return nil
+			}
+			if matchAnyGlob(excludes, rel) {
+				return nil
+			}
+			if !s.searchFile(filepath.Join(root, rel), filepath.Join(path, rel)) {
+				return filepath.SkipAll
+			}
+			return nil
+		})
+		if err != nil {
+			return Result{Success: false, Error: err.Error()}, nil
+		}
+	}
+
+	return Result{Success: true, Output: s.output()}, nil
+}
+
+// searcher collects matching lines across files
+type searcher struct {
+	re        *regexp.Regexp
+	out       strings.Builder
+	matches   int
+	files     int // files with a reported match
+	truncated bool
+}
+
+// searchFile appends the matches in a file to the output
+// Returns false once the total match or output limit is reached
+func (s *searcher) searchFile(path, display string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > searchMaxFileSize {
+		return true
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || isBinary(data) {
+		return true
+	}
+
+	fileMatches := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), searchMaxFileSize)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if !s.re.MatchString(line) {
+			continue
+		}
+
+		fileMatches++
+		if fileMatches > searchMaxMatchesPerFile {
+			continue
+		}
+		if s.matches >= searchMaxMatches || s.out.Len() >= searchMaxOutput {
+			s.truncated = true
+			return false
+		}
+		if fileMatches == 1 {
+			s.files++
+		}
+
+		line = strings.TrimSpace(line)
+		if len(line) > searchMaxLineLength {
+			line = line[:searchMaxLineLength] + "..."
+		}
+		fmt.Fprintf(&s.out, "%s:%d: %s\n", filepath.ToSlash(display), lineNum, line)
+		s.matches++
+	}
+
+	if fileMatches > searchMaxMatchesPerFile {
+		fmt.Fprintf(&s.out, "%s: ... %d more matches in this file\n", filepath.ToSlash(display), fileMatches-searchMaxMatchesPerFile)
+	}
+	return true
+}
+
+func (s *searcher) output() string {
+	if s.matches == 0 {
+		return "No matches found"
+	}
+	out := strings.TrimRight(s.out.String(), "\n")
+	if s.truncated {
+		out += fmt.Sprintf("\n... results truncated after %d matches in %d files, narrow the search with path, include or a more specific pattern", s.matches, s.files)
+	}
+	return out
+}
+
+// isBinary reports whether data looks like a binary file
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+func SearchToolDefinition() llm.Tool {
+	return llm.Tool{
+		Type: "function",
+		Function: llm.ToolDefinition{
+			Name: "search",
+			Description: "Search file contents in the workspace. Returns matching lines as path:line: text. " +
+				"Files ignored by .gitignore are skipped. Prefer this over running grep with bash.",
+			Parameters: llm.Parameters{
+				Type: "object",
+				Properties: map[string]llm.Property{
+					"pattern": {
+						Type:        "string",
+						Description: "Regular expression (Go syntax) to search for",
+					},
+					"path": {
+						Type:        "string",
+						Description: "Directory or file to search in (defaults to current directory)",
+					},
+					"include": {
+						Type:        "string",
+						Description: "Only search files matching these comma-separated globs, e.g. \"*.go\" or \"internal/**/*.go\"",
+					},
+					"exclude": {
+						Type:        "string",
+						Description: "Skip files matching these comma-separated globs",
+					},
+					"literal": {
+						Type:        "boolean",
+						Description: "Treat pattern as plain text instead of a regex",
+					},
+					"ignore_case": {
+						Type:        "boolean",
+						Description: "Match case-insensitively",
+					},
+				},
+				Required: []string{"pattern"},
+			},
+		},
+	}
+}
+
+func (t *SearchTool) Definition() llm.Tool {
+	return SearchToolDefinition()
+}
+
+func (t *SearchTool) ReadOnly() bool { return true }
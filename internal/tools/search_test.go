@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// ignoreFiles is a small repository with nested .gitignore files
+var ignoreFiles = map[string]string{
+	".gitignore":              "*.log\nbuild/\n/secret.txt\n!keep.log\n",
+	"main.go":                 "package main // needle\n",
+	"app.log":                 "needle\n",
+	"keep.log":                "needle\n",
+	"secret.txt":              "needle\n",
+	"build/out.go":            "package build // needle\n",
+	"docs/secret.txt":         "needle\n",
+	"internal/.gitignore":     "*_gen.go\n",
+	"internal/a.go":           "package internal // needle\n",
+	"internal/a_gen.go":       "package internal // needle\n",
+	"node_modules/x/index.js": "needle\n",
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]any
+		want []string
+	}{
+		{
+			name: "gitignore rules",
+			args: map[string]any{"pattern": "needle"},
+			want: []string{"main.go:1:", "keep.log:1:", "docs/secret.txt:1:", "internal/a.go:1:"},
+		},
+		{
+			name: "include glob",
+			args: map[string]any{"pattern": "needle", "include": "*.go"},
+			want: []string{"main.go:1:", "internal/a.go:1:"},
+		},
+		{
+			name: "exclude glob with directories",
+			args: map[string]any{"pattern": "needle", "exclude": "internal/**, *.log"},
+			want: []string{"main.go:1:", "docs/secret.txt:1:"},
+		},
+		{
+			name: "path inside the workspace",
+			args: map[string]any{"pattern": "package", "path": "internal"},
+			want: []string{"internal/a.go:1:"},
+		},
+		{
+			name: "an ignored file is searched when named",
+			args: map[string]any{"pattern": "needle", "path": "app.log"},
+			want: []string{"app.log:1:"},
+		},
+		{
+			name: "literal",
+			args: map[string]any{"pattern": "main //", "literal": true},
+			want: []string{"main.go:1:"},
+		},
+		{
+			name: "ignore case",
+			args: map[string]any{"pattern": "NEEDLE", "ignore_case": true, "include": "internal/*"},
+			want: []string{"internal/a.go:1:"},
+		},
+	}
+
+	ws := newTestWorkspace(t, ignoreFiles)
+	tool := NewSearchTool(ws)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tool.Execute(context.Background(), tt.args)
+			if err != nil || !result.Success {
+				t.Fatalf("search failed: %v %s", err, result.Error)
+			}
+			assertLines(t, result.Output, tt.want)
+		})
+	}
+}
+
+func TestSearchErrors(t *testing.T) {
+	ws := newTestWorkspace(t, ignoreFiles)
+	tool := NewSearchTool(ws)
+
+	result, _ := tool.Execute(context.Background(), map[string]any{"pattern": "a("})
+	if result.Success || !strings.Contains(result.Error, "literal=true") {
+		t.Errorf("invalid regex result %+v, want a hint to use literal", result)
+	}
+	result, _ = tool.Execute(context.Background(), map[string]any{"pattern": "x", "path": "../"})
+	if result.Success {
+		t.Errorf("search outside the workspace succeeded: %s", result.Output)
+	}
+	result, _ = tool.Execute(context.Background(), map[string]any{"pattern": "no such text"})
+	if !result.Success || result.Output != "No matches found" {
+		t.Errorf("no match result %+v", result)
+	}
+}
+
+// assertLines checks that output has exactly one line starting with each prefix in want
+func assertLines(t *testing.T, output string, want []string) {
+	t.Helper()
+	lines := strings.Split(output, "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), output)
+	}
+	for _, w := range want {
+		found := false
+		for _, line := range lines {
+			if strings.HasPrefix(line, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("no line starting with %q in:\n%s", w, output)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Most symlinks followed when resolving a single path
+const maxSymlinks = 40
+
+// Workspace confines the file tools to a root directory
+// Paths are checked after resolving symlinks, so a link inside the root that points
+// outside of it is refused as well
+type Workspace struct {
+	root     string // absolute root as given
+	realRoot string // root with symlinks resolved
+	allow    []string
+}
+
+// NewWorkspace creates a workspace rooted at root, or the current directory if root is empty
+// allow lists paths outside the root that may still be accessed. An entry is either a
+// directory or file, which allows everything below it, or a glob pattern where ** matches
+// any number of directories. Relative entries are relative to the root and ~ is expanded
+func NewWorkspace(root string, allow []string) (*Workspace, error) {
+	if root == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get working directory: %w", err)
+		}
+		root = wd
+	}
+	root, err := filepath.Abs(expandHome(root))
+	if err != nil {
+		return nil, fmt.Errorf("invalid workspace root: %w", err)
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workspace root: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("workspace root %s is not a directory", root)
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workspace root: %w", err)
+	}
+
+	w := &Workspace{root: root, realRoot: realRoot}
+	for _, entry := range allow {
+		entry = expandHome(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if !filepath.IsAbs(entry) {
+			entry = filepath.Join(root, entry)
+		}
+		entry = filepath.Clean(entry)
+		if !strings.ContainsAny(entry, "*?[") {
+			// Allow the real location of the entry too so links to it keep working
+			if real, err := realPath(entry); err == nil && real != entry {
+				w.allow = append(w.allow, real)
+			}
+		}
+		w.allow = append(w.allow, entry)
+	}
+	return w, nil
+}
+
+// Root returns the workspace root directory
+// A nil workspace has no root and paths are relative to the current directory
+func (w *Workspace) Root() string {
+	if w == nil {
+		return ""
+	}
+	return w.root
+}
+
+// Resolve returns the absolute path for a tool path argument
+// Relative paths are resolved against the root. An error meant for the model is returned
+// if the path, after following symlinks, is outside the root and not allowed
+func (w *Workspace) Resolve(path string) (string, error) {
+	if w == nil {
+		return path, nil
+	}
+
+	abs := expandHome(path)
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(w.root, abs)
+	}
+	abs = filepath.Clean(abs)
+
+	real, err := realPath(abs)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve %s: %v", path, err)
+	}
+	if within(w.realRoot, real) || w.allowed(real) {
+		return abs, nil
+	}
+
+	msg := fmt.Sprintf("access denied: %s is outside the workspace %s", path, w.root)
+	if real != abs {
+		msg = fmt.Sprintf("access denied: %s resolves to %s, which is outside the workspace %s", path, real, w.root)
+	}
+	return "", fmt.Errorf("%s. Only files inside the workspace can be accessed, use a path relative to it. "+
+		"The user can allow other paths with workspace.allow in the config", msg)
+}
+
+// allowed reports whether path matches an allow-list entry
+func (w *Workspace) allowed(path string) bool {
+	for _, entry := range w.allow {
+		if strings.ContainsAny(entry, "*?[") {
+			if matchGlob(filepath.ToSlash(entry), filepath.ToSlash(path)) {
+				return true
+			}
+		} else if within(entry, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// within reports whether path is dir or inside it
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// realPath resolves the symlinks in path
+// Missing trailing components are kept as they are, so paths of files about to be
+// created can be checked too. Dangling links are followed to where they point
+func realPath(path string) (string, error) {
+	var rest []string
+	for links := 0; ; {
+		real, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{real}, rest...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		if info, lerr := os.Lstat(path); lerr == nil && info.Mode()&os.ModeSymlink != 0 {
+			// A link to a file that doesn't exist yet, writing it would create the target
+			links++
+			if links > maxSymlinks {
+				return "", fmt.Errorf("too many levels of symbolic links")
+			}
+			target, err := os.Readlink(path)
+			if err != nil {
+				return "", err
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(path), target)
+			}
+			path = filepath.Clean(target)
+			continue
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		rest = append([]string{filepath.Base(path)}, rest...)
+		path = parent
+	}
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
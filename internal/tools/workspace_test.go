@@ -0,0 +1,104 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWorkspaceResolve(t *testing.T) {
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{
+		filepath.Join(root, "sub"),
+		outside,
+		filepath.Join(base, "shared"),
+		filepath.Join(base, "docs", "a"),
+	} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"out":      outside,
+		"out-rel":  "../outside",
+		"secret":   filepath.Join(outside, "secret.txt"),
+		"dangling": filepath.Join(outside, "new.txt"),
+		"sub-link": "sub",
+		"shared":   filepath.Join(base, "shared"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ws, err := NewWorkspace(root, []string{"../shared", filepath.Join(base, "docs", "**", "*.md")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want string // resolved path, empty when access is denied
+	}{
+		{path: "a.go", want: filepath.Join(root, "a.go")},
+		{path: "sub/../b.go", want: filepath.Join(root, "b.go")},
+		{path: filepath.Join(root, "sub", "new", "c.go"), want: filepath.Join(root, "sub", "new", "c.go")},
+		{path: "sub-link/d.go", want: filepath.Join(root, "sub-link", "d.go")},
+		{path: "../outside/secret.txt"},
+		{path: filepath.Join(outside, "secret.txt")},
+		{path: "out/secret.txt"},
+		{path: "out-rel/secret.txt"},
+		{path: "secret"},
+		{path: "dangling"},
+		{path: "../shared/notes.txt", want: filepath.Join(base, "shared", "notes.txt")},
+		{path: "shared/notes.txt", want: filepath.Join(root, "shared", "notes.txt")},
+		{path: "../docs/a/readme.md", want: filepath.Join(base, "docs", "a", "readme.md")},
+		{path: "../docs/a/readme.txt"},
+		{path: "../sharedx/a.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := ws.Resolve(tt.path)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("Resolve(%q) = %q, want access denied", tt.path, got)
+				}
+				if !strings.Contains(err.Error(), "access denied") {
+					t.Errorf("error %q, want access denied", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve(%q) failed: %v", tt.path, err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithin(t *testing.T) {
+	tests := []struct {
+		dir, path string
+		want      bool
+	}{
+		{"/a/b", "/a/b", true},
+		{"/a/b", "/a/b/c", true},
+		{"/a/b", "/a/bc", false},
+		{"/a/b", "/a", false},
+		{"/a/b", "/a/b/..c", true},
+	}
+	for _, tt := range tests {
+		if got := within(tt.dir, tt.path); got != tt.want {
+			t.Errorf("within(%q, %q) = %v, want %v", tt.dir, tt.path, got, tt.want)
+		}
+	}
+}
@@ -2,41 +2,40 @@ package tui
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"os"
-	"path/filepath"
 	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/DanielNikkari/maahinen/internal/agent"
 	"github.com/DanielNikkari/maahinen/internal/config"
 	"github.com/DanielNikkari/maahinen/internal/llm"
+	"github.com/DanielNikkari/maahinen/internal/mcp"
 	"github.com/DanielNikkari/maahinen/internal/ollama"
+	"github.com/DanielNikkari/maahinen/internal/session"
 	"github.com/DanielNikkari/maahinen/internal/tools"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
-// ToolConfirmation represents a pending tool confirmation request
+// ToolConfirmation represents a pending confirmation request for the tool calls of a turn
 type ToolConfirmation struct {
-	ID        string
-	Name      string
-	Arguments map[string]any
-	Response  chan bool // true = confirmed, false = denied
+	Calls    []ToolCallMsg
+	Response chan agent.Confirmation
 }
 
-// TUIAgent wraps the agent functionality for TUI integration
+// TUIAgent adapts the agent to the TUI, translating agent events into tea messages
 type TUIAgent struct {
-	client   *llm.Client
-	messages []llm.Message
-	tools    *tools.Registry
-	program  *tea.Program
-	model    *Model
-	logFile  *os.File
+	agent   *agent.Agent
+	client  *llm.Client
+	program *tea.Program
+	model   *Model
+	store   *session.Store
+	procs   *tools.ProcessManager
+	servers *mcp.Manager
 
 	// Tool confirmation
-	autoConfirm      bool
 	pendingConfirm   *ToolConfirmation
 	pendingConfirmMu sync.Mutex
 
@@ -46,90 +45,190 @@ type TUIAgent struct {
 
 // NewTUIAgent creates a new TUI-integrated agent
 func NewTUIAgent(client *llm.Client, registry *tools.Registry, cfg *config.Config) *TUIAgent {
-	// Register tools in registry
-	for _, tool := range registry.All() {
-		client.RegisterTool(tool.Definition())
-	}
-
-	// Set up tool call logging
-	logDir := "logs"
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		log.Printf("Warning: could not create logs directory: %v", err)
-	}
-
-	logPath := filepath.Join(logDir, fmt.Sprintf("tools_%s.log", time.Now().Format("2006-01-02")))
-	logFile, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Printf("Warning: could not open tool log file: %v", err)
-	}
-
-	// Use config values or defaults
-	systemPrompt := cfg.Agent.SystemPrompt
-	if systemPrompt == "" {
-		systemPrompt = config.DefaultConfig().Agent.SystemPrompt
-	}
-
 	spinnerStyle := cfg.UI.SpinnerStyle
 	if spinnerStyle == "" {
 		spinnerStyle = "dots"
 	}
 
-	return &TUIAgent{
+	a := &TUIAgent{
+		agent:        agent.New(client, registry, cfg),
 		client:       client,
-		tools:        registry,
-		logFile:      logFile,
-		autoConfirm:  cfg.Agent.AutoConfirm,
 		spinnerStyle: spinnerStyle,
-		messages: []llm.Message{
-			{
-				Role:    llm.RoleSystem,
-				Content: systemPrompt,
-			},
-		},
 	}
+	a.agent.SetSink(agent.SinkFunc(a.handleEvent))
+	a.agent.SetConfirmer(agent.ConfirmFunc(a.requestToolConfirmation))
+	return a
 }
 
 // SetAutoConfirm sets whether tools should be auto-confirmed
 func (a *TUIAgent) SetAutoConfirm(auto bool) {
-	a.autoConfirm = auto
+	a.agent.SetAutoConfirm(auto)
+}
+
+// SetProcessManager shows the background processes started by the tools in the tool panel
+// Call before SetProgram
+func (a *TUIAgent) SetProcessManager(procs *tools.ProcessManager) {
+	a.procs = procs
+}
+
+// SetMCPManager enables the /mcp command and reports servers that failed to start
+// Call before SetProgram
+func (a *TUIAgent) SetMCPManager(servers *mcp.Manager) {
+	a.servers = servers
+}
+
+// SetSessionStore enables saving sessions to the given store
+func (a *TUIAgent) SetSessionStore(store *session.Store) {
+	a.store = store
+	a.agent.SetSessionStore(store)
+}
+
+// ResumeSession continues a stored session
+// Call before SetProgram so the UI is rebuilt from the session on start
+func (a *TUIAgent) ResumeSession(s *session.Session) {
+	a.agent.ResumeSession(s)
 }
 
 // SetProgram sets the tea.Program for sending messages
 func (a *TUIAgent) SetProgram(p *tea.Program, m *Model) {
 	a.program = p
 	a.model = m
-	m.SetModel(a.client.Model())
-	m.SetAutoConfirmTools(a.autoConfirm)
+	m.SetModel(a.agent.Model())
+	m.SetGenerationOptions(a.agent.Options().String())
+	m.SetAutoConfirmTools(a.agent.AutoConfirm())
+
+	// Rebuild the UI if a session was resumed
+	if sess := a.agent.Session(); sess.HasHistory() {
+		m.RestoreSession(sessionToUI(sess))
+	}
 
 	// Set up the message callback
 	m.SetOnSendMessage(func(content string) {
-		go a.handleUserMessage(content)
+		go func() {
+			a.handleUserMessage(content)
+			a.program.Send(TurnDoneMsg{})
+		}()
 	})
 
 	// Set up tool confirmation callback
-	m.SetOnToolConfirm(func(confirmed bool) {
-		a.handleToolConfirmation(confirmed)
+	m.SetOnToolConfirm(func(choice ConfirmChoice) {
+		a.handleToolConfirmation(choice)
 	})
 
 	// Set up auto-confirm toggle callback
 	m.SetOnAutoConfirmToggle(func(enabled bool) {
-		a.autoConfirm = enabled
+		a.agent.SetAutoConfirm(enabled)
+	})
+
+	// Set up cancel callback
+	m.SetOnCancel(func() {
+		a.agent.Cancel()
 	})
 
 	// Set up prune callback
 	m.SetOnPrune(func() {
 		a.pruneContext()
 	})
+
+	// Servers that failed to start only show up here and in /mcp
+	if a.servers != nil {
+		for _, st := range a.servers.Status() {
+			if st.State == mcp.StateFailed {
+				m.AddSystemMessage(fmt.Sprintf("MCP server '%s' failed to start: %s", st.Name, st.Error))
+			}
+		}
+	}
+
+	// Keep the background process list up to date
+	if a.procs != nil {
+		a.procs.SetOnChange(func() {
+			a.program.Send(ProcessesMsg{Processes: a.procs.List()})
+		})
+	}
+}
+
+// handleEvent translates agent events into TUI messages
+func (a *TUIAgent) handleEvent(e agent.Event) {
+	if a.program == nil {
+		return
+	}
+
+	switch e := e.(type) {
+	case agent.StreamChunkEvent:
+		a.program.Send(StreamChunkMsg{
+			Content: e.Content,
+			Done:    e.Done,
+		})
+	case agent.ToolCallPreparingEvent:
+		a.program.Send(ToolCallPreparingMsg{})
+	case agent.ToolCallEvent:
+		// Send tool call to TUI (for display in tool panel)
+		a.program.Send(ToolCallMsg{
+			ID:        e.ID,
+			Name:      e.Name,
+			Arguments: e.Arguments,
+		})
+		// Add tool call as one-liner to message history
+		a.program.Send(ResponseMsg{
+			Role:       "toolcall",
+			Content:    fmt.Sprintf("%s(%s)", e.Name, formatToolArgsOneLine(e.Arguments)),
+			ToolCallID: e.ID,
+		})
+	case agent.ToolOutputEvent:
+		a.program.Send(ToolOutputMsg{ID: e.ID, Line: e.Line})
+	case agent.ToolResultEvent:
+		a.program.Send(ToolResultMsg{
+			ID:        e.ID,
+			Name:      e.Name,
+			Success:   e.Success,
+			Cancelled: e.Cancelled,
+			Output:    e.Output,
+			Error:     e.Error,
+		})
+	case agent.ToolCancelledEvent:
+		// Send cancelled message to TUI (for display in tool panel)
+		a.program.Send(ToolCancelledMsg{
+			ID:        e.ID,
+			Name:      e.Name,
+			Arguments: e.Arguments,
+		})
+		// Add cancelled tool call to message history (dimmed)
+		a.program.Send(ResponseMsg{
+			Role:       "toolcall_cancelled",
+			Content:    fmt.Sprintf("%s(%s) - cancelled", e.Name, formatToolArgsOneLine(e.Arguments)),
+			ToolCallID: e.ID,
+		})
+	case agent.TurnCancelledEvent:
+		a.program.Send(TurnCancelledMsg{})
+	case agent.ErrorEvent:
+		a.program.Send(ErrorMsg{Error: e.Err})
+	case agent.ModelChangedEvent:
+		a.program.Send(ModelChangedMsg{Model: e.Model})
+	case agent.OptionsChangedEvent:
+		a.program.Send(OptionsChangedMsg{Options: e.Options.String()})
+	case agent.ContextCompactedEvent:
+		a.program.Send(ContextCompactedMsg{Before: e.Before, After: e.After})
+	}
 }
 
 // handleToolConfirmation handles user's tool confirmation response
-func (a *TUIAgent) handleToolConfirmation(confirmed bool) {
+func (a *TUIAgent) handleToolConfirmation(choice ConfirmChoice) {
 	a.pendingConfirmMu.Lock()
 	pending := a.pendingConfirm
 	a.pendingConfirmMu.Unlock()
 
-	if pending != nil && pending.Response != nil {
-		pending.Response <- confirmed
+	if pending == nil || pending.Response == nil {
+		return
+	}
+	switch choice {
+	case ConfirmYes:
+		pending.Response <- agent.ConfirmAllow
+	case ConfirmSession:
+		pending.Response <- agent.ConfirmAllowSession
+	case ConfirmAlways:
+		pending.Response <- agent.ConfirmAllowAlways
+	default:
+		pending.Response <- agent.ConfirmDeny
 	}
 }
 
@@ -147,14 +246,8 @@ func (a *TUIAgent) handleUserMessage(content string) {
 		return
 	}
 
-	// Add user message to history
-	a.messages = append(a.messages, llm.Message{
-		Role:    llm.RoleUser,
-		Content: content,
-	})
-
-	// Process with LLM
-	a.processResponse()
+	// Errors and cancellation are reported through the event sink
+	_ = a.agent.Run(context.Background(), content)
 }
 
 // handleCommand processes slash commands
@@ -164,26 +257,42 @@ func (a *TUIAgent) handleCommand(input string) {
 		return
 	}
 
+	// Accept space separated arguments too, e.g. "/set temperature 0.2"
+	if fields := strings.Fields(parts[1]); len(fields) > 1 {
+		parts = append(append([]string{parts[0]}, fields...), parts[2:]...)
+	}
+
 	switch parts[1] {
 	case "model":
 		a.handleModelCommand(parts[2:])
 	case "spinner":
 		a.handleSpinnerCommand(parts[2:])
 	case "autoconfirm":
-		a.autoConfirm = !a.autoConfirm
-		a.model.SetAutoConfirmTools(a.autoConfirm)
+		autoConfirm := !a.agent.AutoConfirm()
+		a.agent.SetAutoConfirm(autoConfirm)
+		a.model.SetAutoConfirmTools(autoConfirm)
 		status := "disabled"
-		if a.autoConfirm {
+		if autoConfirm {
 			status = "enabled"
 		}
 		a.program.Send(ResponseMsg{
 			Role:    "system",
 			Content: fmt.Sprintf("Auto-confirm tools: %s", status),
 		})
+	case "permissions":
+		a.handlePermissionsCommand()
+	case "mcp":
+		a.handleMCPCommand()
 	case "help":
 		a.handleHelpCommand()
 	case "prune":
 		a.handlePruneCommand()
+	case "compact":
+		a.handleCompactCommand()
+	case "session":
+		a.handleSessionCommand(parts[2:])
+	case "set":
+		a.handleSetCommand(parts[2:])
 	default:
 		a.program.Send(ResponseMsg{
 			Role:    "system",
@@ -196,11 +305,17 @@ func (a *TUIAgent) handleModelCommand(args []string) {
 	if len(args) == 0 {
 		a.program.Send(ResponseMsg{
 			Role:    "system",
-			Content: fmt.Sprintf("Current model: %s", a.client.Model()),
+			Content: fmt.Sprintf("Current model: %s", a.agent.Model()),
 		})
 		return
 	}
 
+	// Only Ollama can pull models, other servers serve a fixed set
+	if a.client.Provider() != llm.ProviderOllama {
+		a.handleServerModelCommand(args)
+		return
+	}
+
 	ollamaURL := a.client.BaseURL()
 
 	switch args[0] {
@@ -217,7 +332,7 @@ func (a *TUIAgent) handleModelCommand(args []string) {
 		var sb strings.Builder
 		sb.WriteString("Installed models:\n")
 		for _, m := range models {
-			if m.Name == a.client.Model() {
+			if m.Name == a.agent.Model() {
 				sb.WriteString(fmt.Sprintf("  * %s (current)\n", m.Name))
 			} else {
 				sb.WriteString(fmt.Sprintf("    %s\n", m.Name))
@@ -249,8 +364,7 @@ func (a *TUIAgent) handleModelCommand(args []string) {
 
 		if found {
 			// Model already installed, switch to it
-			a.client.SetModel(modelName)
-			a.program.Send(ModelChangedMsg{Model: modelName})
+			a.agent.SetModel(modelName)
 			a.program.Send(ResponseMsg{
 				Role:    "system",
 				Content: fmt.Sprintf("Switched to model: %s", modelName),
@@ -286,8 +400,7 @@ func (a *TUIAgent) handleModelCommand(args []string) {
 			}
 
 			// Successfully pulled, update the message and switch
-			a.client.SetModel(modelName)
-			a.program.Send(ModelChangedMsg{Model: modelName})
+			a.agent.SetModel(modelName)
 			a.program.Send(UpdateLastMessageMsg{
 				Content: fmt.Sprintf("Successfully pulled and switched to model: %s", modelName),
 			})
@@ -295,6 +408,53 @@ func (a *TUIAgent) handleModelCommand(args []string) {
 	}
 }
 
+// handleServerModelCommand lists and switches models on an OpenAI-compatible server
+func (a *TUIAgent) handleServerModelCommand(args []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	models, err := a.client.ListModels(ctx)
+	if err != nil {
+		a.program.Send(ResponseMsg{
+			Role:    "system",
+			Content: fmt.Sprintf("Error listing models: %v", err),
+		})
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		var sb strings.Builder
+		sb.WriteString("Available models:\n")
+		for _, m := range models {
+			if m == a.agent.Model() {
+				sb.WriteString(fmt.Sprintf("  * %s (current)\n", m))
+			} else {
+				sb.WriteString(fmt.Sprintf("    %s\n", m))
+			}
+		}
+		a.program.Send(ResponseMsg{
+			Role:    "system",
+			Content: sb.String(),
+		})
+	default:
+		modelName := args[0]
+		if !slices.Contains(models, modelName) {
+			a.program.Send(ResponseMsg{
+				Role:    "system",
+				Content: fmt.Sprintf("Model '%s' is not available on %s", modelName, a.client.BaseURL()),
+			})
+			return
+		}
+
+		a.agent.SetModel(modelName)
+		a.program.Send(ResponseMsg{
+			Role:    "system",
+			Content: fmt.Sprintf("Switched to model: %s", modelName),
+		})
+	}
+}
+
 func (a *TUIAgent) handleSpinnerCommand(args []string) {
 	if len(args) == 0 {
 		a.program.Send(ResponseMsg{
@@ -348,7 +508,16 @@ func (a *TUIAgent) handleHelpCommand() {
 /spinner/list    List available spinners
 /spinner/{name}  Switch to spinner
 /prune           Clear message history and context
+/compact         Summarize older messages to free context
+/session         Show current session
+/session/list    List saved sessions
+/session/new     Start a new session
+/session/resume/{id}  Resume a saved session
+/set             Show generation options
+/set/{name}/{value}  Set an option for this session (e.g. /set temperature 0.2)
 /autoconfirm     Toggle auto-confirm for tools
+/permissions     Show tool permission rules
+/mcp             Show MCP servers and their tools
 /help            Show this help
 exit, quit       Exit Maahinen`
 
@@ -358,278 +527,247 @@ exit, quit       Exit Maahinen`
 	})
 }
 
-func (a *TUIAgent) handlePruneCommand() {
-	a.pruneContext()
+func (a *TUIAgent) handlePermissionsCommand() {
+	rules := a.agent.PermissionRules()
+	if len(rules) == 0 {
+		a.program.Send(ResponseMsg{
+			Role:    "system",
+			Content: "No permission rules, every tool call asks for confirmation unless auto-confirm is on",
+		})
+		return
+	}
+
+	lines := []string{"Permission rules (deny rules win, otherwise the first match decides):"}
+	for _, r := range rules {
+		lines = append(lines, "  "+r.String())
+	}
 	a.program.Send(ResponseMsg{
 		Role:    "system",
-		Content: "Context cleared. Message history has been pruned.",
+		Content: strings.Join(lines, "\n"),
 	})
 }
 
-// pruneContext clears the message history while keeping the system prompt
-func (a *TUIAgent) pruneContext() {
-	// Keep only the system message
-	if len(a.messages) > 0 && a.messages[0].Role == llm.RoleSystem {
-		a.messages = a.messages[:1]
-	} else {
-		a.messages = []llm.Message{}
+func (a *TUIAgent) handleMCPCommand() {
+	var statuses []mcp.ServerStatus
+	if a.servers != nil {
+		statuses = a.servers.Status()
 	}
-
-	// Clear the UI
-	a.model.ClearMessages()
-}
-
-// processResponse handles LLM response processing with streaming
-func (a *TUIAgent) processResponse() {
-	for {
-		var resp *llm.Message
-		var streamErr error
-
-		// Use streaming to show response as it's generated
-		resp, streamErr = a.client.ChatStream(a.messages, func(chunk string, done bool, fullMessage *llm.Message) {
-			if !done && chunk != "" {
-				// Send each chunk to the TUI for display
-				a.program.Send(StreamChunkMsg{
-					Content: chunk,
-					Done:    false,
-				})
-			}
+	if len(statuses) == 0 {
+		a.program.Send(ResponseMsg{
+			Role:    "system",
+			Content: "No MCP servers configured, add them to the mcp section of config.yaml",
 		})
+		return
+	}
 
-		if streamErr != nil {
-			a.program.Send(ErrorMsg{Error: streamErr})
-			return
+	lines := []string{"MCP servers:"}
+	for _, st := range statuses {
+		header := fmt.Sprintf("  %s (%s)", st.Name, st.State)
+		if st.Server != "" {
+			header += " - " + st.Server
 		}
-
-		a.messages = append(a.messages, *resp)
-
-		// Check for native tool calls
-		if resp.HasToolCalls() {
-			// Signal end of streaming before handling tools
-			a.program.Send(StreamChunkMsg{Content: "", Done: true})
-
-			for _, tc := range resp.ToolCalls {
-				_, err := a.executeTool(tc)
-				if err != nil {
-					a.program.Send(ErrorMsg{Error: err})
-					return
-				}
+		lines = append(lines, header, "    command: "+st.Command)
+		if st.Error != "" {
+			for _, line := range strings.Split(st.Error, "\n") {
+				lines = append(lines, "    "+line)
 			}
-			continue // Continue the conversation with tool results
 		}
-
-		// Check for JSON tool calls in content
-		if tc, ok := tools.ParseToolCallFromContent(resp.Content); ok {
-			// Signal end of streaming before handling tools
-			a.program.Send(StreamChunkMsg{Content: "", Done: true})
-
-			_, err := a.executeTool(*tc)
-			if err != nil {
-				a.program.Send(ErrorMsg{Error: err})
-				return
-			}
+		if st.State == mcp.StateDisabled || st.State == mcp.StateFailed {
+			continue
+		}
+		if len(st.Tools) == 0 {
+			lines = append(lines, "    no tools")
 			continue
 		}
+		lines = append(lines, fmt.Sprintf("    %d tools: %s", len(st.Tools), strings.Join(st.Tools, ", ")))
+	}
+	a.program.Send(ResponseMsg{
+		Role:    "system",
+		Content: strings.Join(lines, "\n"),
+	})
+}
 
-		// Regular text response - signal completion
-		if resp.Content != "" {
-			a.program.Send(StreamChunkMsg{Content: "", Done: true})
+func (a *TUIAgent) handleSetCommand(args []string) {
+	if len(args) == 0 || args[0] == "" {
+		current := a.agent.Options().String()
+		if current == "" {
+			current = "(server defaults)"
 		}
+		a.program.Send(ResponseMsg{
+			Role: "system",
+			Content: fmt.Sprintf("Generation options: %s\nAvailable: %s\nUse /set/{name}/default to remove an override",
+				current, strings.Join(llm.OptionNames, ", ")),
+		})
+		return
+	}
+
+	if len(args) < 2 {
+		a.program.Send(ResponseMsg{
+			Role:    "system",
+			Content: fmt.Sprintf("Usage: /set/%s/{value}", args[0]),
+		})
+		return
+	}
+
+	// Rejoin the value in case it contained slashes, e.g. a stop sequence like </s>
+	name, value := args[0], strings.Join(args[1:], "/")
+	if err := a.agent.SetOption(name, value); err != nil {
+		a.program.Send(ResponseMsg{
+			Role:    "system",
+			Content: fmt.Sprintf("Error: %v", err),
+		})
 		return
 	}
+
+	a.program.Send(ResponseMsg{
+		Role:    "system",
+		Content: fmt.Sprintf("Set %s for this session: %s", name, value),
+	})
 }
 
-// processResponseNonStreaming handles LLM response processing without streaming (kept for reference)
-func (a *TUIAgent) processResponseNonStreaming() {
-	for {
-		resp, err := a.client.Chat(a.messages)
+func (a *TUIAgent) handleSessionCommand(args []string) {
+	if a.store == nil {
+		a.program.Send(ResponseMsg{
+			Role:    "system",
+			Content: "Sessions are not enabled.",
+		})
+		return
+	}
+
+	current := a.agent.Session()
+
+	if len(args) == 0 || args[0] == "" {
+		a.program.Send(ResponseMsg{
+			Role:    "system",
+			Content: fmt.Sprintf("Current session: %s (%s)", current.ID, current.Title()),
+		})
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		sessions, err := a.store.List()
 		if err != nil {
-			a.program.Send(ErrorMsg{Error: err})
+			a.program.Send(ResponseMsg{
+				Role:    "system",
+				Content: fmt.Sprintf("Error listing sessions: %v", err),
+			})
 			return
 		}
-
-		a.messages = append(a.messages, *resp)
-
-		// Check for native tool calls
-		if resp.HasToolCalls() {
-			for _, tc := range resp.ToolCalls {
-				_, err := a.executeTool(tc)
-				if err != nil {
-					a.program.Send(ErrorMsg{Error: err})
-					return
-				}
-			}
-			continue
+		if len(sessions) == 0 {
+			a.program.Send(ResponseMsg{
+				Role:    "system",
+				Content: "No saved sessions.",
+			})
+			return
 		}
 
-		// Check for JSON tool calls in content
-		if tc, ok := tools.ParseToolCallFromContent(resp.Content); ok {
-			_, err := a.executeTool(*tc)
-			if err != nil {
-				a.program.Send(ErrorMsg{Error: err})
-				return
+		var sb strings.Builder
+		sb.WriteString("Saved sessions:\n")
+		for _, s := range sessions {
+			marker := "   "
+			if s.ID == current.ID {
+				marker = "  *"
 			}
-			continue
+			sb.WriteString(fmt.Sprintf("%s %s  %s  [%s]  %s\n",
+				marker, s.ID, s.UpdatedAt.Format("2006-01-02 15:04"), s.Model, s.Title()))
 		}
-
-		// Regular text response
-		if resp.Content != "" {
+		a.program.Send(ResponseMsg{
+			Role:    "system",
+			Content: sb.String(),
+		})
+	case "new":
+		a.agent.NewSession()
+		a.program.Send(SessionRestoredMsg{})
+		a.program.Send(ResponseMsg{
+			Role:    "system",
+			Content: fmt.Sprintf("Started new session: %s", a.agent.Session().ID),
+		})
+	case "resume":
+		if len(args) < 2 || args[1] == "" {
 			a.program.Send(ResponseMsg{
-				Role:    "assistant",
-				Content: resp.Content,
+				Role:    "system",
+				Content: "Usage: /session/resume/{id}. Use /session/list to see saved sessions.",
 			})
+			return
 		}
-		return
-	}
-}
 
-// executeTool executes a tool call and logs it
-// Returns (wasExecuted, error)
-func (a *TUIAgent) executeTool(tc llm.ToolCall) (bool, error) {
-	toolName := tc.Function.Name
-
-	// Map common tool name mistakes
-	switch toolName {
-	case "go", "python", "shell", "sh", "cmd", "command", "terminal":
-		toolName = "bash"
-	case "file_read", "read_file":
-		toolName = "read"
-	case "file_write", "write_file", "create_file":
-		toolName = "write"
-	case "file_edit", "edit_file":
-		toolName = "edit"
-	case "file_list", "list_files", "ls", "dir":
-		toolName = "list"
-	}
-
-	// Generate a unique ID for this tool call
-	toolID := fmt.Sprintf("%s_%d", toolName, time.Now().UnixNano())
-
-	// Request confirmation if needed
-	if !a.autoConfirm {
-		confirmed := a.requestToolConfirmation(toolID, toolName, tc.Function.Arguments)
-		if !confirmed {
-			a.logToolCall(toolID, toolName, tc.Function.Arguments, "denied by user")
-			// Send cancelled message to TUI (for display in tool panel)
-			a.program.Send(ToolCancelledMsg{
-				ID:        toolID,
-				Name:      toolName,
-				Arguments: tc.Function.Arguments,
-			})
-			// Add cancelled tool call to message history (dimmed)
-			argsOneLine := formatToolArgsOneLine(tc.Function.Arguments)
+		s, err := a.store.Load(args[1])
+		if err != nil {
 			a.program.Send(ResponseMsg{
-				Role:    "toolcall_cancelled",
-				Content: fmt.Sprintf("%s(%s) - cancelled", toolName, argsOneLine),
-			})
-			// Add denial message to conversation
-			a.messages = append(a.messages, llm.Message{
-				Role:    llm.RoleTool,
-				Content: "Tool execution was denied by the user.",
+				Role:    "system",
+				Content: fmt.Sprintf("Error: %v", err),
 			})
-			return false, nil
+			return
 		}
-	}
-
-	// Send tool call to TUI (for display in tool panel)
-	a.program.Send(ToolCallMsg{
-		ID:        toolID,
-		Name:      toolName,
-		Arguments: tc.Function.Arguments,
-	})
-
-	// Add tool call as one-liner to message history
-	argsOneLine := formatToolArgsOneLine(tc.Function.Arguments)
-	a.program.Send(ResponseMsg{
-		Role:    "toolcall",
-		Content: fmt.Sprintf("%s(%s)", toolName, argsOneLine),
-	})
 
-	// Log the tool call
-	a.logToolCall(toolID, toolName, tc.Function.Arguments, "started")
-
-	tool, ok := a.tools.Get(toolName)
-	if !ok {
-		availableTools := strings.Join(a.tools.List(), ", ")
-		errMsg := fmt.Sprintf("Unknown tool '%s'. Available tools: %s", tc.Function.Name, availableTools)
-
-		a.program.Send(ToolResultMsg{
-			ID:      toolID,
-			Name:    toolName,
-			Success: false,
-			Error:   errMsg,
+		a.agent.ResumeSession(s)
+		messages, toolCalls := sessionToUI(s)
+		a.program.Send(SessionRestoredMsg{Messages: messages, ToolCalls: toolCalls})
+		a.program.Send(ResponseMsg{
+			Role:    "system",
+			Content: fmt.Sprintf("Resumed session: %s (%s)", s.ID, s.Title()),
 		})
-
-		a.logToolCall(toolID, toolName, nil, "error: unknown tool")
-
-		a.messages = append(a.messages, llm.Message{
-			Role:    llm.RoleTool,
-			Content: errMsg,
+	default:
+		a.program.Send(ResponseMsg{
+			Role:    "system",
+			Content: fmt.Sprintf("Unknown session command: %s", args[0]),
 		})
-		return true, nil
 	}
+}
 
-	// Execute the tool
-	result, err := tool.Execute(context.Background(), tc.Function.Arguments)
+func (a *TUIAgent) handleCompactCommand() {
+	before, after, err := a.agent.Compact(context.Background())
+	if errors.Is(err, context.Canceled) {
+		a.program.Send(ResponseMsg{Role: "system", Content: "Compaction cancelled"})
+		return
+	}
 	if err != nil {
-		a.program.Send(ToolResultMsg{
-			ID:      toolID,
-			Name:    toolName,
-			Success: false,
-			Error:   err.Error(),
+		a.program.Send(ResponseMsg{
+			Role:    "system",
+			Content: fmt.Sprintf("Could not compact context: %v", err),
 		})
-		a.logToolCall(toolID, toolName, nil, fmt.Sprintf("execution error: %v", err))
-		return true, err
+		return
 	}
 
-	// Send result to TUI
-	a.program.Send(ToolResultMsg{
-		ID:      toolID,
-		Name:    toolName,
-		Success: result.Success,
-		Output:  result.Output,
-		Error:   result.Error,
+	a.program.Send(ResponseMsg{
+		Role:    "system",
+		Content: fmt.Sprintf("Context compacted: ~%d → ~%d tokens (context window %d)", before, after, a.agent.ContextWindow()),
 	})
+}
 
-	// Log result
-	status := "success"
-	if !result.Success {
-		status = fmt.Sprintf("failed: %s", result.Error)
-	}
-	a.logToolCall(toolID, toolName, nil, status)
-
-	// Update tool call in message history based on result
-	if !result.Success {
-		argsOneLine := formatToolArgsOneLine(tc.Function.Arguments)
-		failedContent := fmt.Sprintf("%s(%s) - failed: %s", toolName, argsOneLine, result.Error)
-		a.model.UpdateToolCallStatus(toolName, "toolcall_failed", failedContent)
-	}
-
-	// Add tool result to messages
-	toolOutput := result.Output
-	if toolOutput == "" && result.Success {
-		toolOutput = "Command executed successfully (no output)"
-	} else if !result.Success {
-		toolOutput = fmt.Sprintf("Command failed: %s\nOutput: %s", result.Error, result.Output)
-	}
-
-	a.messages = append(a.messages, llm.Message{
-		Role:    llm.RoleTool,
-		Content: toolOutput,
+func (a *TUIAgent) handlePruneCommand() {
+	a.pruneContext()
+	a.program.Send(ResponseMsg{
+		Role:    "system",
+		Content: "Context cleared. Message history has been pruned.",
 	})
+}
+
+// pruneContext clears the message history while keeping the system prompt
+func (a *TUIAgent) pruneContext() {
+	a.agent.Prune()
 
-	return true, nil
+	// Clear the UI
+	a.model.ClearMessages()
 }
 
 // requestToolConfirmation requests user confirmation for a tool call
-func (a *TUIAgent) requestToolConfirmation(id, name string, args map[string]any) bool {
-	responseChan := make(chan bool, 1)
+func (a *TUIAgent) requestToolConfirmation(calls []agent.ToolCallEvent) agent.Confirmation {
+	responseChan := make(chan agent.Confirmation, 1)
+
+	msgs := make([]ToolCallMsg, len(calls))
+	for i, call := range calls {
+		msgs[i] = ToolCallMsg{
+			ID:        call.ID,
+			Name:      call.Name,
+			Arguments: call.Arguments,
+		}
+	}
 
 	confirmation := &ToolConfirmation{
-		ID:        id,
-		Name:      name,
-		Arguments: args,
-		Response:  responseChan,
+		Calls:    msgs,
+		Response: responseChan,
 	}
 
 	a.pendingConfirmMu.Lock()
@@ -637,49 +775,21 @@ func (a *TUIAgent) requestToolConfirmation(id, name string, args map[string]any)
 	a.pendingConfirmMu.Unlock()
 
 	// Send confirmation request to TUI
-	a.program.Send(ToolConfirmRequestMsg{
-		ID:        id,
-		Name:      name,
-		Arguments: args,
-	})
+	a.program.Send(ToolConfirmRequestMsg{Calls: msgs})
 
 	// Wait for response
-	confirmed := <-responseChan
+	answer := <-responseChan
 
 	a.pendingConfirmMu.Lock()
 	a.pendingConfirm = nil
 	a.pendingConfirmMu.Unlock()
 
-	return confirmed
-}
-
-// logToolCall logs a tool call to the log file
-func (a *TUIAgent) logToolCall(id, name string, args map[string]any, status string) {
-	if a.logFile == nil {
-		return
-	}
-
-	timestamp := time.Now().Format(time.RFC3339)
-	argsStr := ""
-	if args != nil {
-		var parts []string
-		for k, v := range args {
-			parts = append(parts, fmt.Sprintf("%s=%v", k, v))
-		}
-		argsStr = strings.Join(parts, ", ")
-	}
-
-	logLine := fmt.Sprintf("[%s] %s | tool=%s | args={%s} | status=%s\n",
-		timestamp, id, name, argsStr, status)
-
-	a.logFile.WriteString(logLine)
+	return answer
 }
 
 // Close cleans up resources
 func (a *TUIAgent) Close() {
-	if a.logFile != nil {
-		a.logFile.Close()
-	}
+	a.agent.Close()
 }
 
 // formatToolArgsOneLine formats tool arguments as a short one-liner
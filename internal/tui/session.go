@@ -0,0 +1,86 @@
+package tui
+
+import (
+	"fmt"
+
+	"github.com/DanielNikkari/maahinen/internal/llm"
+	"github.com/DanielNikkari/maahinen/internal/session"
+)
+
+// sessionToUI rebuilds the chat history and tool panel records from a stored session
+func sessionToUI(s *session.Session) ([]ChatMessage, []ToolCallRecord) {
+	messages := []ChatMessage{}
+	toolCalls := []ToolCallRecord{}
+	for _, tc := range s.ToolCalls {
+		toolCalls = append(toolCalls, ToolCallRecord{
+			ID:        tc.ID,
+			Name:      tc.Name,
+			Arguments: tc.Arguments,
+			Status:    tc.Status,
+			Output:    tc.Output,
+			Error:     tc.Error,
+		})
+	}
+
+	byID := map[string]int{}
+	for i, tc := range toolCalls {
+		if tc.ID != "" {
+			byID[tc.ID] = i
+		}
+	}
+
+	// Tool results are matched to their records by ID. Sessions saved before tool calls had
+	// IDs are matched by position: each result belongs to the next record, counted from the
+	// end since compaction may have removed older tool results.
+	toolResults := 0
+	for _, msg := range s.Messages {
+		if msg.Role == llm.RoleTool {
+			toolResults++
+		}
+	}
+	next := max(0, len(toolCalls)-toolResults)
+	for _, msg := range s.Messages {
+		switch msg.Role {
+		case llm.RoleUser:
+			messages = append(messages, ChatMessage{Role: "user", Content: msg.Content})
+		case llm.RoleAssistant:
+			if msg.Content != "" {
+				messages = append(messages, ChatMessage{Role: "assistant", Content: "\n" + msg.Content})
+			}
+		case llm.RoleTool:
+			var tc ToolCallRecord
+			if i, ok := byID[msg.ToolCallID]; ok && msg.ToolCallID != "" {
+				tc = toolCalls[i]
+			} else if next < len(toolCalls) {
+				tc = toolCalls[next]
+				next++
+			} else {
+				continue
+			}
+
+			argsOneLine := formatToolArgsOneLine(tc.Arguments)
+			switch tc.Status {
+			case "cancelled":
+				messages = append(messages, ChatMessage{
+					Role:       "toolcall_cancelled",
+					Content:    fmt.Sprintf("%s(%s) - cancelled", tc.Name, argsOneLine),
+					ToolCallID: tc.ID,
+				})
+			case "error":
+				messages = append(messages, ChatMessage{
+					Role:       "toolcall_failed",
+					Content:    fmt.Sprintf("%s(%s) - failed: %s", tc.Name, argsOneLine, tc.Error),
+					ToolCallID: tc.ID,
+				})
+			default:
+				messages = append(messages, ChatMessage{
+					Role:       "toolcall",
+					Content:    fmt.Sprintf("%s(%s)", tc.Name, argsOneLine),
+					ToolCallID: tc.ID,
+				})
+			}
+		}
+	}
+
+	return messages, toolCalls
+}
@@ -125,6 +125,10 @@ var (
 	ToolRunningStyle = lipgloss.NewStyle().
 				Foreground(ColorWarning)
 
+	ToolOutputStyle = lipgloss.NewStyle().
+			Foreground(ColorTextDim).
+			Italic(true)
+
 	ToolCancelledStyle = lipgloss.NewStyle().
 				Foreground(lipgloss.Color("9")) // Bright red (ANSI) for container compatibility
 )
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/DanielNikkari/maahinen/internal/tools"
 	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
@@ -17,6 +18,8 @@ const (
 	maxInputHeight     = 10
 	toolPanelWidth     = 40
 	commandMenuMaxShow = 7
+	// Lines of live output shown for a running tool call
+	toolTailLines = 5
 )
 
 // Message types for TUI communication
@@ -30,6 +33,8 @@ type (
 	ResponseMsg struct {
 		Role    string
 		Content string
+		// ToolCallID links tool call lines to their tool panel record
+		ToolCallID string
 	}
 
 	// ToolCallMsg is sent when a tool is being executed (for display)
@@ -39,20 +44,33 @@ type (
 		Arguments map[string]any
 	}
 
-	// ToolConfirmRequestMsg is sent when agent wants user to confirm a tool
+	// ToolConfirmRequestMsg is sent when agent wants user to confirm the tool calls of a turn
 	ToolConfirmRequestMsg struct {
-		ID        string
-		Name      string
-		Arguments map[string]any
+		Calls []ToolCallMsg
+	}
+
+	// ToolCallPreparingMsg is sent when the streamed response starts a tool call
+	ToolCallPreparingMsg struct{}
+
+	// ToolOutputMsg is sent for each line a running tool prints
+	ToolOutputMsg struct {
+		ID   string
+		Line string
+	}
+
+	// ProcessesMsg is sent when a background process starts or ends
+	ProcessesMsg struct {
+		Processes []tools.ProcessInfo
 	}
 
 	// ToolResultMsg is sent when a tool execution completes
 	ToolResultMsg struct {
-		ID      string
-		Name    string
-		Success bool
-		Output  string
-		Error   string
+		ID        string
+		Name      string
+		Success   bool
+		Cancelled bool
+		Output    string
+		Error     string
 	}
 
 	// ToolCancelledMsg is sent when a tool is cancelled by the user
@@ -68,6 +86,12 @@ type (
 		Done    bool
 	}
 
+	// TurnCancelledMsg is sent when the user cancelled the turn in progress
+	TurnCancelledMsg struct{}
+
+	// TurnDoneMsg is sent when the agent has finished handling the submitted input
+	TurnDoneMsg struct{}
+
 	// ErrorMsg is sent when an error occurs
 	ErrorMsg struct {
 		Error error
@@ -78,10 +102,27 @@ type (
 		Model string
 	}
 
+	// OptionsChangedMsg is sent when the generation options change
+	OptionsChangedMsg struct {
+		Options string
+	}
+
 	// UpdateLastMessageMsg updates the last message in place (for progress)
 	UpdateLastMessageMsg struct {
 		Content string
 	}
+
+	// ContextCompactedMsg is sent when older turns were summarized to free up context
+	ContextCompactedMsg struct {
+		Before int
+		After  int
+	}
+
+	// SessionRestoredMsg replaces the chat history and tool calls with a resumed session
+	SessionRestoredMsg struct {
+		Messages  []ChatMessage
+		ToolCalls []ToolCallRecord
+	}
 )
 
 // Command represents an available slash command
@@ -97,7 +138,15 @@ var availableCommands = []Command{
 	{Name: "/spinner", Description: "Show current spinner", HasSubcmds: true},
 	{Name: "/spinner/list", Description: "List available spinners", HasSubcmds: false},
 	{Name: "/prune", Description: "Clear message history", HasSubcmds: false},
+	{Name: "/compact", Description: "Summarize older messages to free context", HasSubcmds: false},
+	{Name: "/session", Description: "Show current session", HasSubcmds: true},
+	{Name: "/session/list", Description: "List saved sessions", HasSubcmds: false},
+	{Name: "/session/new", Description: "Start a new session", HasSubcmds: false},
+	{Name: "/session/resume", Description: "Resume a saved session by ID", HasSubcmds: true},
+	{Name: "/set", Description: "Show or set generation options", HasSubcmds: true},
 	{Name: "/autoconfirm", Description: "Toggle tool auto-confirm on/off.", HasSubcmds: false},
+	{Name: "/permissions", Description: "Show tool permission rules.", HasSubcmds: false},
+	{Name: "/mcp", Description: "Show MCP servers and their tools", HasSubcmds: false},
 	{Name: "/help", Description: "Show available commands", HasSubcmds: false},
 }
 
@@ -105,6 +154,8 @@ var availableCommands = []Command{
 type ChatMessage struct {
 	Role    string
 	Content string
+	// ToolCallID is set on tool call lines
+	ToolCallID string
 }
 
 // ToolCallRecord represents a tool call in the tool panel
@@ -115,6 +166,10 @@ type ToolCallRecord struct {
 	Status    string // "pending", "running", "success", "error"
 	Output    string
 	Error     string
+	// Started is when the call started running
+	Started time.Time
+	// Tail holds the last lines printed while the call is running
+	Tail []string
 }
 
 // Model is the main TUI model
@@ -127,6 +182,7 @@ type Model struct {
 	messageViewport viewport.Model
 	chatInput       textarea.Model
 	toolCalls       []ToolCallRecord
+	processes       []tools.ProcessInfo
 
 	// State
 	messages         []ChatMessage
@@ -135,14 +191,18 @@ type Model struct {
 	commandMenuIndex int
 	filteredCommands []Command
 	currentModel     string
+	currentOptions   string
 	isProcessing     bool
+	turnRunning      bool // from submit until the agent finishes, including running tools
 	streamBuffer     strings.Builder
+	preparingTool    bool
 	autoConfirmTools bool
+	toolTicking      bool
 
 	// Confirmation dialog
 	showConfirmDialog   bool
-	pendingToolCall     *ToolCallMsg
-	confirmDialogChoice int // 0 = confirm, 1 = deny
+	pendingToolCalls    []ToolCallMsg
+	confirmDialogChoice ConfirmChoice
 
 	// Markdown renderer
 	mdRenderer *glamour.TermRenderer
@@ -154,9 +214,28 @@ type Model struct {
 
 	// Callbacks (set by the integrating code)
 	onSendMessage       func(string)
-	onToolConfirm       func(bool)
+	onToolConfirm       func(ConfirmChoice)
 	onAutoConfirmToggle func(bool)
 	onPrune             func()
+	onCancel            func()
+}
+
+// ConfirmChoice is an option of the tool confirmation dialog
+type ConfirmChoice int
+
+// Confirmation dialog options in the order they are shown
+const (
+	ConfirmYes ConfirmChoice = iota
+	ConfirmNo
+	ConfirmSession
+	ConfirmAlways
+)
+
+var confirmChoiceLabels = []string{
+	ConfirmYes:     "yes",
+	ConfirmNo:      "no",
+	ConfirmSession: "yes, don't ask again this session",
+	ConfirmAlways:  "yes, always allow (saves a rule)",
 }
 
 // NewModel creates a new TUI model
@@ -203,6 +282,11 @@ func (m *Model) SetModel(model string) {
 	m.currentModel = model
 }
 
+// SetGenerationOptions sets the generation options shown in the header
+func (m *Model) SetGenerationOptions(options string) {
+	m.currentOptions = options
+}
+
 // SetAutoConfirmTools sets whether tools should be auto-confirmed
 func (m *Model) SetAutoConfirmTools(auto bool) {
 	m.autoConfirmTools = auto
@@ -214,7 +298,7 @@ func (m *Model) SetOnSendMessage(fn func(string)) {
 }
 
 // SetOnToolConfirm sets the callback for when user confirms/denies a tool
-func (m *Model) SetOnToolConfirm(fn func(bool)) {
+func (m *Model) SetOnToolConfirm(fn func(ConfirmChoice)) {
 	m.onToolConfirm = fn
 }
 
@@ -228,6 +312,11 @@ func (m *Model) SetOnPrune(fn func()) {
 	m.onPrune = fn
 }
 
+// SetOnCancel sets the callback for when the user cancels the turn in progress
+func (m *Model) SetOnCancel(fn func()) {
+	m.onCancel = fn
+}
+
 // ClearMessages clears all messages and tool calls from the UI
 func (m *Model) ClearMessages() {
 	m.messages = []ChatMessage{}
@@ -236,6 +325,20 @@ func (m *Model) ClearMessages() {
 	m.renderMessages()
 }
 
+// RestoreSession replaces the chat history and tool calls
+func (m *Model) RestoreSession(messages []ChatMessage, toolCalls []ToolCallRecord) {
+	m.messages = messages
+	m.toolCalls = toolCalls
+	m.streamBuffer.Reset()
+	m.renderMessages()
+	m.messageViewport.GotoBottom()
+}
+
+// AddSystemMessage shows a system message, for use before the program runs
+func (m *Model) AddSystemMessage(content string) {
+	m.addMessage("system", content)
+}
+
 // SetSpinnerStyle sets the spinner animation style
 func (m *Model) SetSpinnerStyle(style string) {
 	m.spinnerStyle = style
@@ -261,6 +364,15 @@ func GetAvailableSpinners() []string {
 // spinnerTickMsg is sent to animate the spinner
 type spinnerTickMsg struct{}
 
+// toolTickMsg refreshes the elapsed time of running tool calls
+type toolTickMsg struct{}
+
+func tickTools() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
+		return toolTickMsg{}
+	})
+}
+
 // tickSpinner returns a command that sends a spinner tick after a delay
 func tickSpinner() tea.Cmd {
 	return tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg {
@@ -298,7 +410,7 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case ResponseMsg:
 		m.isProcessing = false // Must be set BEFORE addMessage which calls renderMessages
-		m.addMessage(msg.Role, msg.Content)
+		m.addToolCallMessage(msg.Role, msg.Content, msg.ToolCallID)
 		return m, nil
 
 	case ToolCallMsg:
@@ -308,18 +420,52 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			Name:      msg.Name,
 			Arguments: msg.Arguments,
 			Status:    "running",
+			Started:   time.Now(),
 		})
+		if !m.toolTicking {
+			m.toolTicking = true
+			return m, tickTools()
+		}
 		return m, nil
 
-	case ToolConfirmRequestMsg:
-		// Agent wants user to confirm a tool - show dialog
-		m.pendingToolCall = &ToolCallMsg{
-			ID:        msg.ID,
-			Name:      msg.Name,
-			Arguments: msg.Arguments,
+	case ProcessesMsg:
+		m.processes = msg.Processes
+		if !m.toolTicking {
+			m.toolTicking = true
+			return m, tickTools()
 		}
+		return m, nil
+
+	case ToolOutputMsg:
+		for i := range m.toolCalls {
+			if m.toolCalls[i].ID == msg.ID {
+				tail := append(m.toolCalls[i].Tail, msg.Line)
+				m.toolCalls[i].Tail = tail[max(0, len(tail)-toolTailLines):]
+				break
+			}
+		}
+		return m, nil
+
+	case toolTickMsg:
+		// The view is redrawn after every message, keep ticking while anything runs
+		for _, tc := range m.toolCalls {
+			if tc.Status == "running" {
+				return m, tickTools()
+			}
+		}
+		for _, p := range m.processes {
+			if p.Running {
+				return m, tickTools()
+			}
+		}
+		m.toolTicking = false
+		return m, nil
+
+	case ToolConfirmRequestMsg:
+		// Agent wants user to confirm the turn's tools - show dialog
+		m.pendingToolCalls = msg.Calls
 		m.showConfirmDialog = true
-		m.confirmDialogChoice = 0
+		m.confirmDialogChoice = ConfirmYes
 		return m, nil
 
 	case ToolResultMsg:
@@ -339,26 +485,72 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		})
 		return m, nil
 
+	case ToolCallPreparingMsg:
+		m.preparingTool = true
+		m.updateStreamingMessage()
+		return m, nil
+
 	case StreamChunkMsg:
 		m.streamBuffer.WriteString(msg.Content)
 		if msg.Done {
 			m.isProcessing = false // Must be set BEFORE addMessage which calls renderMessages
-			m.addMessage("assistant", m.streamBuffer.String())
+			m.preparingTool = false
+			// A response that only held tool calls leaves nothing to show
+			if strings.TrimSpace(m.streamBuffer.String()) != "" {
+				m.addMessage("assistant", m.streamBuffer.String())
+			} else {
+				m.renderMessages()
+			}
 			m.streamBuffer.Reset()
 		} else {
 			m.updateStreamingMessage()
 		}
 		return m, nil
 
+	case TurnDoneMsg:
+		// Only cleared here, the agent still saves the session after a cancel or error
+		m.turnRunning = false
+		if m.isProcessing {
+			m.isProcessing = false
+			m.renderMessages()
+		}
+		return m, nil
+
+	case TurnCancelledMsg:
+		m.isProcessing = false // Must be set BEFORE addMessage which calls renderMessages
+		m.preparingTool = false
+		// Keep any partially streamed response
+		if m.streamBuffer.Len() > 0 {
+			m.addMessage("assistant", m.streamBuffer.String())
+			m.streamBuffer.Reset()
+		}
+		m.addMessage("system", "Cancelled.")
+		return m, nil
+
 	case ErrorMsg:
 		m.isProcessing = false // Must be set BEFORE addMessage which calls renderMessages
+		m.preparingTool = false
 		m.addMessage("system", fmt.Sprintf("Error: %v", msg.Error))
 		return m, nil
 
+	case OptionsChangedMsg:
+		m.currentOptions = msg.Options
+		return m, nil
+
 	case ModelChangedMsg:
 		m.currentModel = msg.Model
 		return m, nil
 
+	case ContextCompactedMsg:
+		// Shown mid-turn, so the processing state is left untouched
+		m.addMessage("system", fmt.Sprintf("Context compacted: ~%d → ~%d tokens", msg.Before, msg.After))
+		return m, nil
+
+	case SessionRestoredMsg:
+		m.isProcessing = false
+		m.RestoreSession(msg.Messages, msg.ToolCalls)
+		return m, nil
+
 	case UpdateLastMessageMsg:
 		// Update the last message in place (for progress updates)
 		if len(m.messages) > 0 {
@@ -410,9 +602,12 @@ func (m *Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 	switch keyStr {
 	case "ctrl+c":
-		// If there's selected text, copy it; otherwise quit
+		// Cancel the turn in progress, otherwise quit
 		// Note: Terminal selection/copy is handled by the terminal itself
-		// ctrl+c without selection should quit
+		if m.turnRunning && m.onCancel != nil {
+			m.onCancel()
+			return m, nil
+		}
 		return m, tea.Quit
 
 	case "ctrl+t":
@@ -459,10 +654,11 @@ func (m *Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 		// Submit message
 		content := strings.TrimSpace(m.chatInput.Value())
-		if content != "" && !m.isProcessing {
+		if content != "" && !m.turnRunning {
 			m.chatInput.Reset()
 			m.chatInput.SetHeight(minInputHeight)
 			m.isProcessing = true
+			m.turnRunning = true
 			m.spinnerIndex = 0
 
 			if m.onSendMessage != nil {
@@ -519,6 +715,10 @@ func (m *Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.commandMenuIndex = 0
 			return m, nil
 		}
+		// Cancel the turn in progress
+		if m.turnRunning && m.onCancel != nil {
+			m.onCancel()
+		}
 		return m, nil
 
 	case "tab":
@@ -545,43 +745,38 @@ func (m *Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 func (m *Model) handleConfirmDialogKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "up", "k":
-		// Move selection up (to Yes)
 		if m.confirmDialogChoice > 0 {
 			m.confirmDialogChoice--
 		}
 		return m, nil
 	case "down", "j":
-		// Move selection down (to No)
-		if m.confirmDialogChoice < 1 {
+		if int(m.confirmDialogChoice) < len(confirmChoiceLabels)-1 {
 			m.confirmDialogChoice++
 		}
 		return m, nil
 	case "enter":
-		confirmed := m.confirmDialogChoice == 0
-		m.showConfirmDialog = false
-		m.pendingToolCall = nil
-		if m.onToolConfirm != nil {
-			m.onToolConfirm(confirmed)
-		}
-		return m, nil
+		m.answerConfirmDialog(m.confirmDialogChoice)
 	case "y":
-		m.showConfirmDialog = false
-		m.pendingToolCall = nil
-		if m.onToolConfirm != nil {
-			m.onToolConfirm(true)
-		}
-		return m, nil
+		m.answerConfirmDialog(ConfirmYes)
 	case "n", "esc":
-		m.showConfirmDialog = false
-		m.pendingToolCall = nil
-		if m.onToolConfirm != nil {
-			m.onToolConfirm(false)
-		}
-		return m, nil
+		m.answerConfirmDialog(ConfirmNo)
+	case "a":
+		m.answerConfirmDialog(ConfirmSession)
+	case "s":
+		m.answerConfirmDialog(ConfirmAlways)
 	}
 	return m, nil
 }
 
+// answerConfirmDialog closes the confirmation dialog with the given choice
+func (m *Model) answerConfirmDialog(choice ConfirmChoice) {
+	m.showConfirmDialog = false
+	m.pendingToolCalls = nil
+	if m.onToolConfirm != nil {
+		m.onToolConfirm(choice)
+	}
+}
+
 func (m *Model) updateLayout() {
 	if m.width == 0 || m.height == 0 {
 		return
@@ -691,12 +886,18 @@ func (m *Model) filterCommands(prefix string) {
 }
 
 func (m *Model) addMessage(role, content string) {
+	m.addToolCallMessage(role, content, "")
+}
+
+// addToolCallMessage adds a message that belongs to the tool call with the given ID
+func (m *Model) addToolCallMessage(role, content, toolCallID string) {
 	if role == "assistant" {
 		content = "\n" + content
 	}
 	m.messages = append(m.messages, ChatMessage{
-		Role:    role,
-		Content: content,
+		Role:       role,
+		Content:    content,
+		ToolCallID: toolCallID,
 	})
 	m.renderMessages()
 	m.messageViewport.GotoBottom()
@@ -771,8 +972,13 @@ func (m *Model) renderMessages() {
 			} else {
 				sb.WriteString(AssistantMessageStyle.Width(contentWidth).Render(streamContent) + "\n")
 			}
+		}
+		switch {
+		case m.preparingTool:
+			sb.WriteString(SpinnerStyle.Render(spinnerFrame+" Preparing tool call...") + "\n")
+		case m.streamBuffer.Len() > 0:
 			sb.WriteString(SpinnerStyle.Render(spinnerFrame) + "\n")
-		} else {
+		default:
 			sb.WriteString(SpinnerStyle.Render(spinnerFrame+" Thinking...") + "\n")
 		}
 	}
@@ -783,12 +989,21 @@ func (m *Model) renderMessages() {
 func (m *Model) handleToolResult(tr ToolResultMsg) {
 	for i := range m.toolCalls {
 		if m.toolCalls[i].ID == tr.ID {
-			if tr.Success {
+			if tr.Cancelled {
+				m.toolCalls[i].Status = "cancelled"
+				m.toolCalls[i].Output = tr.Output
+				argsOneLine := formatToolArgsOneLine(m.toolCalls[i].Arguments)
+				m.UpdateToolCallStatus(tr.ID, "toolcall_cancelled", fmt.Sprintf("%s(%s) - cancelled", tr.Name, argsOneLine))
+			} else if tr.Success {
 				m.toolCalls[i].Status = "success"
 				m.toolCalls[i].Output = tr.Output
 			} else {
 				m.toolCalls[i].Status = "error"
 				m.toolCalls[i].Error = tr.Error
+				// Update tool call in message history to show the failure
+				argsOneLine := formatToolArgsOneLine(m.toolCalls[i].Arguments)
+				failedContent := fmt.Sprintf("%s(%s) - failed: %s", tr.Name, argsOneLine, tr.Error)
+				m.UpdateToolCallStatus(tr.ID, "toolcall_failed", failedContent)
 			}
 			break
 		}
@@ -808,7 +1023,7 @@ func (m *Model) View() string {
 	statusBar := m.renderStatusBar()
 
 	// If confirmation dialog is showing, overlay it on the message panel
-	if m.showConfirmDialog && m.pendingToolCall != nil {
+	if m.showConfirmDialog && len(m.pendingToolCalls) > 0 {
 		messagePanel = m.overlayConfirmDialog(messagePanel)
 	}
 
@@ -847,6 +1062,9 @@ func (m *Model) View() string {
 func (m *Model) renderHeader() string {
 	title := HeaderStyle.Render("Maahinen")
 	model := ModelIndicatorStyle.Render(fmt.Sprintf("[%s]", m.currentModel))
+	if m.currentOptions != "" {
+		model += " " + HelpStyle.Render(m.currentOptions)
+	}
 
 	// Separator style (always dimmed)
 	sep := HelpStyle.Render(" | ")
@@ -910,6 +1128,28 @@ func (m *Model) renderChatPanel() string {
 func (m *Model) renderToolPanel() string {
 	var sb strings.Builder
 
+	if len(m.processes) > 0 {
+		sb.WriteString(ToolNameStyle.Render("Background Processes") + "\n")
+		sb.WriteString(strings.Repeat("─", toolPanelWidth-4) + "\n")
+		for _, p := range m.processes {
+			status := ToolRunningStyle.Render(fmt.Sprintf("#%d running %s", p.ID, p.Runtime()))
+			switch {
+			case p.Killed:
+				status = ToolCancelledStyle.Render(fmt.Sprintf("#%d killed", p.ID))
+			case !p.Running && p.ExitCode == 0:
+				status = ToolSuccessStyle.Render(fmt.Sprintf("#%d %s", p.ID, p.Status()))
+			case !p.Running:
+				status = ToolErrorStyle.Render(fmt.Sprintf("#%d %s", p.ID, p.Status()))
+			}
+			command := strings.ReplaceAll(p.Command, "\n", " ")
+			if len(command) > toolPanelWidth-8 {
+				command = command[:toolPanelWidth-11] + "..."
+			}
+			sb.WriteString(status + "\n" + ToolArgsStyle.Render("  "+command) + "\n")
+		}
+		sb.WriteString("\n")
+	}
+
 	sb.WriteString(ToolNameStyle.Render("Tool Calls") + "\n")
 	sb.WriteString(strings.Repeat("─", toolPanelWidth-4) + "\n")
 
@@ -943,6 +1183,9 @@ func (m *Model) renderToolPanel() string {
 					nameStyled = ToolPendingStyle.Render(tc.Name)
 				case "running":
 					nameStyled = ToolRunningStyle.Render(tc.Name)
+					if !tc.Started.IsZero() {
+						nameStyled += ToolArgsStyle.Render(fmt.Sprintf(" (%s)", time.Since(tc.Started).Round(time.Second)))
+					}
 				case "success":
 					nameStyled = ToolSuccessStyle.Render(tc.Name)
 				default:
@@ -963,6 +1206,16 @@ func (m *Model) renderToolPanel() string {
 						sb.WriteString(ToolArgsStyle.Render("  "+argStr) + "\n")
 					}
 				}
+				if tc.Status == "running" {
+					// Live output of the running command
+					for _, line := range tc.Tail {
+						line = strings.ReplaceAll(line, "\t", "  ")
+						if len(line) > toolPanelWidth-8 {
+							line = line[:toolPanelWidth-11] + "..."
+						}
+						sb.WriteString(ToolOutputStyle.Render("  │ "+line) + "\n")
+					}
+				}
 			}
 		}
 	}
@@ -975,8 +1228,8 @@ func (m *Model) renderToolPanel() string {
 
 func (m *Model) renderStatusBar() string {
 	status := ""
-	if m.isProcessing {
-		status = SpinnerStyle.Render("Processing...")
+	if m.turnRunning {
+		status = SpinnerStyle.Render("Processing...") + HelpStyle.Render(" | Esc: cancel")
 	} else {
 		status = HelpStyle.Render("Enter: send | Shift+Enter: newline | /: commands")
 	}
@@ -1014,7 +1267,7 @@ func (m *Model) overlayCommandMenu(base string) string {
 
 // overlayConfirmDialog overlays a simple confirmation prompt on the message panel
 func (m *Model) overlayConfirmDialog(messagePanel string) string {
-	if m.pendingToolCall == nil {
+	if len(m.pendingToolCalls) == 0 {
 		return messagePanel
 	}
 
@@ -1035,17 +1288,29 @@ func (m *Model) overlayConfirmDialog(messagePanel string) string {
 	var sb strings.Builder
 
 	// Check if one-liner fits
-	argsStr := formatToolArgs(m.pendingToolCall.Arguments, maxDialogWidth)
-	oneLiner := fmt.Sprintf("Confirm tool call %s(%s)?", m.pendingToolCall.Name, argsStr)
-
-	if len(oneLiner) <= maxDialogWidth {
+	call := m.pendingToolCalls[0]
+	argsStr := formatToolArgs(call.Arguments, maxDialogWidth)
+	oneLiner := fmt.Sprintf("Confirm tool call %s(%s)?", call.Name, argsStr)
+
+	if len(m.pendingToolCalls) > 1 {
+		// Several calls from one turn, approved together
+		sb.WriteString(DialogTitleStyle.Render(fmt.Sprintf("Confirm %d tool calls?", len(m.pendingToolCalls))) + "\n")
+		for _, c := range m.pendingToolCalls {
+			line := fmt.Sprintf("  %s(%s)", c.Name, formatToolArgs(c.Arguments, maxDialogWidth))
+			if len(line) > maxDialogWidth {
+				line = line[:maxDialogWidth-3] + "..."
+			}
+			sb.WriteString(ToolArgsStyle.Render(line) + "\n")
+		}
+		sb.WriteString("\n")
+	} else if len(oneLiner) <= maxDialogWidth {
 		// Fits on one line
 		sb.WriteString(DialogTitleStyle.Render(oneLiner) + "\n\n")
 	} else {
 		// Multi-line format
-		sb.WriteString(DialogTitleStyle.Render(fmt.Sprintf("Confirm tool call %s?", m.pendingToolCall.Name)) + "\n")
+		sb.WriteString(DialogTitleStyle.Render(fmt.Sprintf("Confirm tool call %s?", call.Name)) + "\n")
 		// Show each argument on its own line
-		for k, v := range m.pendingToolCall.Arguments {
+		for k, v := range call.Arguments {
 			valStr := fmt.Sprintf("%v", v)
 			maxValLen := maxDialogWidth - len(k) - 4
 			if maxValLen < 20 {
@@ -1059,13 +1324,21 @@ func (m *Model) overlayConfirmDialog(messagePanel string) string {
 		sb.WriteString("\n")
 	}
 
-	// Simple yes/no selection
-	if m.confirmDialogChoice == 0 {
-		sb.WriteString(ConfirmYesSelectedStyle.Render("> yes") + "\n")
-		sb.WriteString(ConfirmNoStyle.Render("  no") + "\n")
-	} else {
-		sb.WriteString(ConfirmYesStyle.Render("  yes") + "\n")
-		sb.WriteString(ConfirmNoSelectedStyle.Render("> no") + "\n")
+	// Choices, with their shortcut keys
+	keys := []string{ConfirmYes: "y", ConfirmNo: "n", ConfirmSession: "a", ConfirmAlways: "s"}
+	for i, label := range confirmChoiceLabels {
+		choice := ConfirmChoice(i)
+		line := fmt.Sprintf("%s (%s)", label, keys[i])
+		switch {
+		case choice == m.confirmDialogChoice && choice == ConfirmNo:
+			sb.WriteString(ConfirmNoSelectedStyle.Render("> "+line) + "\n")
+		case choice == m.confirmDialogChoice:
+			sb.WriteString(ConfirmYesSelectedStyle.Render("> "+line) + "\n")
+		case choice == ConfirmNo:
+			sb.WriteString(ConfirmNoStyle.Render("  "+line) + "\n")
+		default:
+			sb.WriteString(ConfirmYesStyle.Render("  "+line) + "\n")
+		}
 	}
 
 	// Wrap in simple dialog style
@@ -1132,9 +1405,9 @@ func (m *Model) GetMessages() []ChatMessage {
 }
 
 // UpdateToolCallStatus updates a tool call message status in the history
-func (m *Model) UpdateToolCallStatus(toolName, newRole, newContent string) {
+func (m *Model) UpdateToolCallStatus(toolCallID, newRole, newContent string) {
 	for i := len(m.messages) - 1; i >= 0; i-- {
-		if m.messages[i].Role == "toolcall" && strings.HasPrefix(m.messages[i].Content, toolName+"(") {
+		if m.messages[i].Role == "toolcall" && m.messages[i].ToolCallID == toolCallID {
 			m.messages[i].Role = newRole
 			m.messages[i].Content = newContent
 			m.renderMessages()